@@ -8,6 +8,10 @@ const EDDNSubAddress = "tcp://eddn-relay.elite-markets.net:9500"
 // EDDNUploadAddress is a simple constant for the EDDN POST URI.
 const EDDNUploadAddress = "http://eddn-gateway.elite-markets.net:8080/upload/"
 
+// EDDNSecureUploadAddress is the POST URI of the HTTPS gateway now run by
+// EDCD, for use as UploaderOptions.GatewayURL.
+const EDDNSecureUploadAddress = "https://eddn.edcd.io:4430/upload/"
+
 // version contains the current version in the form major, minor, and revision.
 // TODO: Actually implement automation on this.
 var version = [...]int{0, 0, 1}
@@ -0,0 +1,455 @@
+package EDDNClient
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// BackpressurePolicy decides what happens to new messages when a receiver
+// falls behind and the buffer for its channel is full.
+type BackpressurePolicy int
+
+// The available backpressure policies.
+const (
+	PolicyBlock       BackpressurePolicy = iota // Wait for the receiver, stalling the subscriber
+	PolicyDropNewest                            // Discard the message that didn't fit
+	PolicyDropOldest                            // Discard the oldest buffered message to make room
+	PolicySpillToDisk                           // Queue messages on disk until the receiver catches up
+)
+
+// Names of the channels whose buffer sizes may be set individually with
+// ChannelOptions.StreamBuffers.
+const (
+	StreamJournal     = "journal"     // ChannelInterface.JournalChan
+	StreamShipyard    = "shipyard"    // ChannelInterface.ShipyardChan
+	StreamCommodity   = "commodity"   // ChannelInterface.CommodityChan
+	StreamBlackmarket = "blackmarket" // ChannelInterface.BlackmarketChan
+	StreamOutfitting  = "outfitting"  // ChannelInterface.OutfittingChan
+	StreamEvents      = "events"      // EventStream.Events
+)
+
+// delivery is a single decoded message on its way to the receiver.
+type delivery struct {
+	msg        interface{}
+	receivedAt time.Time
+	invalid    []string // Validation failures, for messages flagged by ValidationFlag
+}
+
+// dropCounter counts the messages discarded by backpressure, by schema.
+type dropCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func newDropCounter() *dropCounter {
+	return &dropCounter{counts: make(map[string]uint64)}
+}
+
+// add counts msg as dropped.
+func (counter *dropCounter) add(msg interface{}) {
+	schemaRef, _ := messageEnvelope(msg)
+	counter.addSchema(schemaRef)
+}
+
+// addSchema counts a message of the schema schemaRef as dropped.
+func (counter *dropCounter) addSchema(schemaRef string) {
+	counter.mu.Lock()
+	counter.counts[schemaRef]++
+	counter.mu.Unlock()
+}
+
+// snapshot returns a copy of the current counts.
+func (counter *dropCounter) snapshot() map[string]uint64 {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	counts := make(map[string]uint64, len(counter.counts))
+
+	for schemaRef, count := range counter.counts {
+		counts[schemaRef] = count
+	}
+
+	return counts
+}
+
+// bufferSize returns the buffer size configured for the named stream.
+func (opts *ChannelOptions) bufferSize(stream string) int {
+	if size, ok := opts.StreamBuffers[stream]; ok {
+		return size
+	}
+
+	return opts.BufferSize
+}
+
+// An outlet buffers deliveries for a single channel according to a
+// BackpressurePolicy.  Messages are pushed by the receiving goroutine, and
+// forwarded to the channel by a goroutine of the outlet's own.
+type outlet struct {
+	policy  BackpressurePolicy
+	buffer  chan delivery
+	spill   *spillFile
+	dropped *dropCounter
+	send    func(ctx context.Context, d delivery) bool
+}
+
+// newOutlet creates an outlet that passes deliveries to send, which should
+// block until the receiver takes them or ctx is done.
+func newOutlet(opts *ChannelOptions, stream string, dropped *dropCounter,
+	send func(ctx context.Context, d delivery) bool) (o *outlet, err error) {
+
+	size := opts.bufferSize(stream)
+
+	if size < 0 {
+		size = 0
+	}
+
+	// Dropping, or spilling, needs somewhere to hold at least one message.
+	if opts.Backpressure != PolicyBlock && size == 0 {
+		size = 1
+	}
+
+	o = &outlet{
+		policy:  opts.Backpressure,
+		buffer:  make(chan delivery, size),
+		dropped: dropped,
+		send:    send,
+	}
+
+	if o.policy == PolicySpillToDisk {
+		o.spill, err = newSpillFile(opts.SpillDirectory, stream, opts.registry(),
+			dropped)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// start runs the goroutines forwarding deliveries to the receiver.  They
+// stop when ctx is done, calling wg.Done as they return.
+func (o *outlet) start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case d := <-o.buffer:
+				if !o.send(ctx, d) {
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if o.spill != nil {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			o.spill.drain(ctx, o.buffer)
+		}()
+	}
+}
+
+// push hands d to the outlet, applying its policy if the buffer is full.
+// It returns false if ctx was cancelled while waiting.
+func (o *outlet) push(ctx context.Context, d delivery) bool {
+	switch o.policy {
+	case PolicyDropNewest:
+		select {
+		case o.buffer <- d:
+		default:
+			o.dropped.add(d.msg)
+		}
+
+		return true
+
+	case PolicyDropOldest:
+		for {
+			select {
+			case o.buffer <- d:
+				return true
+			default:
+			}
+
+			// Make room, and try again.  The forwarder may beat us to it, in
+			// which case nothing needs to be dropped.
+			select {
+			case old := <-o.buffer:
+				o.dropped.add(old.msg)
+			default:
+			}
+		}
+
+	case PolicySpillToDisk:
+		if o.spill.push(d, o.buffer) != nil {
+			o.dropped.add(d.msg)
+		}
+
+		return true
+	}
+
+	select {
+	case o.buffer <- d:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close releases any resources held by the outlet.  The forwarding
+// goroutines must have stopped first.
+func (o *outlet) close() {
+	if o.spill != nil {
+		o.spill.close()
+	}
+}
+
+// spillRecord is how a delivery is stored in a spillFile.  SourceVersion
+// isn't part of a message's JSON, so is kept alongside it.
+type spillRecord struct {
+	ReceivedAt    time.Time       `json:"receivedAt"`
+	Message       json.RawMessage `json:"message"`
+	SourceVersion string          `json:"sourceVersion,omitempty"`
+	Invalid       []string        `json:"invalid,omitempty"`
+}
+
+// A spillFile is a FIFO queue of deliveries on disk.  Once anything has
+// been spilled every new delivery is spilled too, until the queue has been
+// drained back into the buffer, so that order is preserved.  Records that
+// can't be read back are counted as dropped.
+type spillFile struct {
+	mu       sync.Mutex
+	file     *os.File
+	registry *SchemaRegistry // Decodes records read back
+	dropped  *dropCounter    // Counts records that can't be read back
+	readAt   int64           // Offset of the next record to read
+	writeAt  int64           // Offset at which the next record is written
+	unread   []string        // $schemaRef of every record not yet read, oldest first
+	pending  int             // Records spilled, but not yet in the buffer
+	wake     chan struct{}   // Signals drain that a record was written
+}
+
+func newSpillFile(dir string, stream string, registry *SchemaRegistry,
+	dropped *dropCounter) (spill *spillFile, err error) {
+	file, err := ioutil.TempFile(dir, "eddn-spill-"+stream+"-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillFile{file: file, registry: registry, dropped: dropped,
+		wake: make(chan struct{}, 1)}, nil
+}
+
+// push places d straight into buffer if nothing is spilled and there is
+// room, and appends it to the file otherwise.
+func (spill *spillFile) push(d delivery, buffer chan<- delivery) (err error) {
+	spill.mu.Lock()
+	defer spill.mu.Unlock()
+
+	if spill.pending == 0 {
+		select {
+		case buffer <- d:
+			return nil
+		default:
+		}
+	}
+
+	msg, err := json.Marshal(d.msg)
+
+	if err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(spillRecord{d.receivedAt, msg,
+		sourceVersion(d.msg), d.invalid})
+
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(record)))
+
+	if _, err = spill.file.WriteAt(append(header, record...), spill.writeAt); err != nil {
+		return err
+	}
+
+	schemaRef, _ := messageEnvelope(d.msg)
+
+	spill.writeAt += int64(len(header) + len(record))
+	spill.unread = append(spill.unread, schemaRef)
+	spill.pending++
+
+	select {
+	case spill.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// next reads the oldest spilled delivery, if there is one.  Records that
+// can't be read back are skipped, and counted as dropped.
+func (spill *spillFile) next() (d delivery, ok bool) {
+	spill.mu.Lock()
+	defer spill.mu.Unlock()
+
+	for spill.readAt != spill.writeAt {
+		header := make([]byte, 4)
+		_, err := spill.file.ReadAt(header, spill.readAt)
+
+		var record []byte
+
+		if err == nil {
+			record = make([]byte, binary.BigEndian.Uint32(header))
+			_, err = spill.file.ReadAt(record, spill.readAt+int64(len(header)))
+		}
+
+		// Should the file become unreadable the rest of it can't be trusted,
+		// so every record left in it is dropped.
+		if err != nil {
+			spill.lose(spill.unread...)
+			spill.readAt = spill.writeAt
+			spill.unread = nil
+			spill.reclaim()
+
+			return d, false
+		}
+
+		schemaRef := spill.unread[0]
+		spill.readAt += int64(len(header) + len(record))
+		spill.unread = spill.unread[1:]
+
+		if d, err = spill.decode(record); err == nil {
+			return d, true
+		}
+
+		spill.lose(schemaRef)
+		spill.reclaim()
+	}
+
+	return d, false
+}
+
+// decode decodes a record read back from the file.
+func (spill *spillFile) decode(record []byte) (d delivery, err error) {
+	var stored spillRecord
+
+	if err = json.Unmarshal(record, &stored); err != nil {
+		return d, err
+	}
+
+	// Fields that could not be decoded were reported when first received.
+	msg, err := decodeJSON(stored.Message, spill.registry, true, ValidationOff)
+
+	if msg == nil {
+		return d, err
+	}
+
+	return delivery{withSourceVersion(msg, stored.SourceVersion),
+		stored.ReceivedAt, stored.Invalid}, nil
+}
+
+// lose counts the spilled records of the given schemas as dropped.
+// spill.mu must be held.
+func (spill *spillFile) lose(schemaRefs ...string) {
+	for _, schemaRef := range schemaRefs {
+		spill.dropped.addSchema(schemaRef)
+		spill.pending--
+	}
+}
+
+// delivered marks the oldest spilled record as being in the buffer.
+func (spill *spillFile) delivered() {
+	spill.mu.Lock()
+	defer spill.mu.Unlock()
+
+	spill.pending--
+	spill.reclaim()
+}
+
+// reclaim empties the file once nothing more is spilled.  spill.mu must be
+// held.
+func (spill *spillFile) reclaim() {
+	if spill.pending == 0 && spill.readAt == spill.writeAt {
+		spill.file.Truncate(0)
+		spill.readAt, spill.writeAt = 0, 0
+	}
+}
+
+// drain moves spilled deliveries into buffer, oldest first, until ctx is
+// done.
+func (spill *spillFile) drain(ctx context.Context, buffer chan<- delivery) {
+	for {
+		d, ok := spill.next()
+
+		if !ok {
+			select {
+			case <-spill.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case buffer <- d:
+			spill.delivered()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sourceVersion returns the SourceVersion of msg, for the types that have
+// one.
+func sourceVersion(msg interface{}) string {
+	switch msg := msg.(type) {
+	case Commodity:
+		return msg.SourceVersion
+	case Outfitting:
+		return msg.SourceVersion
+	case Shipyard:
+		return msg.SourceVersion
+	}
+
+	return ""
+}
+
+// withSourceVersion returns msg with its SourceVersion set to version, for
+// the types that have one.
+func withSourceVersion(msg interface{}, version string) interface{} {
+	switch msg := msg.(type) {
+	case Commodity:
+		msg.SourceVersion = version
+		return msg
+	case Outfitting:
+		msg.SourceVersion = version
+		return msg
+	case Shipyard:
+		msg.SourceVersion = version
+		return msg
+	}
+
+	return msg
+}
+
+// close closes, and removes, the file.
+func (spill *spillFile) close() {
+	spill.file.Close()
+	os.Remove(spill.file.Name())
+}
@@ -0,0 +1,212 @@
+package EDDNClient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testOutlet creates an outlet for policy whose receiver is the returned
+// channel.  Nothing is forwarded until the outlet is started.
+func testOutlet(t *testing.T, policy BackpressurePolicy,
+	size int) (o *outlet, received chan Commodity) {
+
+	received = make(chan Commodity)
+	opts := &ChannelOptions{Backpressure: policy, BufferSize: size,
+		SpillDirectory: t.TempDir()}
+
+	o, err := newOutlet(opts, StreamCommodity, newDropCounter(),
+		func(ctx context.Context, d delivery) bool {
+			select {
+			case received <- d.msg.(Commodity):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return o, received
+}
+
+func testCommodity(station string) delivery {
+	msg := Commodity{SchemaRef: "http://schemas.elite-markets.net/eddn/commodity/3"}
+	msg.Message.StationName = station
+
+	return delivery{msg, time.Now(), nil}
+}
+
+// receiveStations starts o and returns the station names of the first n
+// messages it forwards.
+func receiveStations(t *testing.T, o *outlet, received chan Commodity,
+	n int) (stations []string) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	o.start(ctx, &wg)
+
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-received:
+			stations = append(stations, msg.Message.StationName)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", stations)
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	return stations
+}
+
+func TestOutletDropNewest(t *testing.T) {
+	o, received := testOutlet(t, PolicyDropNewest, 2)
+	defer o.close()
+
+	for _, station := range []string{"a", "b", "c"} {
+		o.push(context.Background(), testCommodity(station))
+	}
+
+	if got := receiveStations(t, o, received, 2); got[0] != "a" || got[1] != "b" {
+		t.Errorf("received %v, want [a b]", got)
+	}
+
+	if got := o.dropped.snapshot()["http://schemas.elite-markets.net/eddn/commodity/3"]; got != 1 {
+		t.Errorf("dropped %d, want 1", got)
+	}
+}
+
+func TestOutletDropOldest(t *testing.T) {
+	o, received := testOutlet(t, PolicyDropOldest, 2)
+	defer o.close()
+
+	for _, station := range []string{"a", "b", "c"} {
+		o.push(context.Background(), testCommodity(station))
+	}
+
+	if got := receiveStations(t, o, received, 2); got[0] != "b" || got[1] != "c" {
+		t.Errorf("received %v, want [b c]", got)
+	}
+}
+
+func TestOutletSpillToDiskKeepsOrder(t *testing.T) {
+	o, received := testOutlet(t, PolicySpillToDisk, 1)
+	defer o.close()
+
+	stations := []string{"a", "b", "c", "d", "e"}
+
+	for _, station := range stations {
+		o.push(context.Background(), testCommodity(station))
+	}
+
+	got := receiveStations(t, o, received, len(stations))
+
+	for i := range stations {
+		if got[i] != stations[i] {
+			t.Fatalf("received %v, want %v", got, stations)
+		}
+	}
+
+	if dropped := o.dropped.snapshot(); len(dropped) != 0 {
+		t.Errorf("dropped %v, want nothing", dropped)
+	}
+}
+
+func TestOutletSpillToDiskKeepsSourceVersion(t *testing.T) {
+	o, received := testOutlet(t, PolicySpillToDisk, 1)
+	defer o.close()
+
+	versions := []string{"", "1", "2"}
+
+	for _, version := range versions {
+		d := testCommodity(version)
+		msg := d.msg.(Commodity)
+		msg.SourceVersion = version
+		d.msg = msg
+
+		o.push(context.Background(), d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	o.start(ctx, &wg)
+
+	for _, version := range versions {
+		if msg := <-received; msg.SourceVersion != version {
+			t.Errorf("got SourceVersion %q, want %q", msg.SourceVersion, version)
+		}
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestSpillFileCountsLostRecords(t *testing.T) {
+	const (
+		commodityRef   = "http://schemas.elite-markets.net/eddn/commodity/3"
+		blackmarketRef = "http://schemas.elite-markets.net/eddn/blackmarket/1"
+	)
+
+	dropped := newDropCounter()
+	spill, err := newSpillFile(t.TempDir(), StreamCommodity, defaultRegistry, dropped)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer spill.close()
+
+	// Nothing fits in an unbuffered channel, so every delivery is spilled.
+	buffer := make(chan delivery)
+
+	for _, d := range []delivery{testCommodity("a"), testCommodity("b"),
+		testCommodity("c"), {Blackmarket{SchemaRef: blackmarketRef}, time.Now(), nil}} {
+
+		if err = spill.push(d, buffer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A record that can't be decoded is skipped.
+	if _, err = spill.file.WriteAt([]byte("x"), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := spill.next()
+
+	if !ok || d.msg.(Commodity).Message.StationName != "b" {
+		t.Fatalf("got %+v, %v after a bad record", d, ok)
+	}
+
+	spill.delivered()
+
+	if got := dropped.snapshot(); got[commodityRef] != 1 || len(got) != 1 {
+		t.Errorf("dropped %v after a bad record", got)
+	}
+
+	// Once the file is unreadable every record left in it is lost.
+	if err = spill.file.Truncate(spill.readAt + 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, ok = spill.next(); ok {
+		t.Fatalf("got %+v from a truncated file", d)
+	}
+
+	if got := dropped.snapshot(); got[commodityRef] != 2 || got[blackmarketRef] != 1 {
+		t.Errorf("dropped %v after truncation", got)
+	}
+
+	if spill.pending != 0 || spill.writeAt != 0 {
+		t.Errorf("%d records still pending, file at %d", spill.pending, spill.writeAt)
+	}
+}
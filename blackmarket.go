@@ -2,12 +2,13 @@ package EDDNClient
 
 // BlackmarketMessage contains the blackmarket data sent to EDDN.
 type BlackmarketMessage struct {
-	Name        string `json:"name"`        // Required
-	Prohibited  bool   `json:"prohibited"`  // Required
-	SellPrice   int    `json:"sellPrice"`   // Required
-	StationName string `json:"stationName"` // Required
-	SystemName  string `json:"systemName"`  // Required
-	Timestamp   string `json:"timestamp"`   // Required
+	Name        string    `json:"name"`        // Required
+	Prohibited  bool      `json:"prohibited"`  // Required
+	SellPrice   int       `json:"sellPrice"`   // Required
+	StationName string    `json:"stationName"` // Required
+	SystemName  string    `json:"systemName"`  // Required
+	Timestamp   Timestamp `json:"timestamp"`   // Required
+	Extras                // Fields not otherwise decoded, see Extras
 }
 
 // Blackmarket is the high level type that contains the entire JSON message.
@@ -15,4 +16,5 @@ type Blackmarket struct {
 	SchemaRef string             `json:"$schemaRef"`
 	Header    Header             `json:"header"`
 	Message   BlackmarketMessage `json:"message"`
+	Extras                       // Fields not otherwise decoded, see Extras
 }
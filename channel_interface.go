@@ -1,21 +1,26 @@
 package EDDNClient
 
 import (
-	"fmt"
-	zmq "github.com/pebbe/zmq4"
-	"log"
+	"context"
+	"errors"
+	"sync"
 	"time"
 )
 
-// Constants used internally by control methods to control the ChannelInterface
-// goroutine.
-const (
-	channelInterfaceClose = iota
-)
+// pollInterval is how long the ChannelInterface goroutine waits for data
+// before checking whether it has been cancelled, unless
+// ChannelOptions.ReceiveTimeout says otherwise.  This bounds how long Close,
+// or a cancelled context, can take to stop a quiet subscriber.
+const pollInterval = 250 * time.Millisecond
+
+// errorBufferSize is the number of errors held for the receiver before any
+// further errors are discarded.
+const errorBufferSize = 64
 
 // An enumeration of filters used to tell the ChannelInterface what data the
 // receiver is interested in.  These can be OR'd together to build any filter
-// the receiver wishes.
+// the receiver wishes.  Each set bit excludes the matching schema family; for
+// anything more selective see Filter, and ChannelOptions.Filter.
 const (
 	FilterNone        = 1 << iota // Filter nothing
 	FilterJournal     = 1 << iota // Filter journal messages
@@ -29,22 +34,50 @@ const (
 // each provide various types of EDDN data separated into their respective
 // channels.  JournalChan, ShipyardChan, CommodityChan, BlackmarketChan,
 // and OutfittingChan each only send messages pertaining to their
-// respective types.  When a Done message is received all processing on the
-// receiver should halt as this means that the ChannelInterface is closed.
+// respective types.  Every channel is closed exactly once when the
+// ChannelInterface stops, after which Done is closed as well.
+//
+// Messages that cannot be received or decoded are reported on Errors as a
+// *MessageError, and receiving carries on with the next message.  Messages
+// with fields that could not be decoded are delivered all the same, after
+// an error of kind ErrorField is reported.  Should the relay be lost the
+// ChannelInterface reconnects, as described by ChannelOptions, and reports
+// each change of connection state on States.  Both are buffered, and values
+// are discarded rather than stalling the subscriber if nobody reads them.
+//
+// By default every message channel is unbuffered, and a receiver that falls
+// behind on any one of them stalls the rest.  ChannelOptions.BufferSize,
+// StreamBuffers, and Backpressure change this, and Dropped reports any
+// messages that were discarded as a result.
 //
 // It should be noted that the Journal channel can send several types that
 // must be asserted by the caller.  While this may be a bit tedious it
 // does provide type correctness, and allows the caller to know precisely
 // what data was provided by EDDN.
 type ChannelInterface struct {
-	Socket          *zmq.Socket        // Underlying ZeroMQ socket
-	JournalChan     <-chan Journal     // Channel for journal messages. (Provides many message types.)
-	ShipyardChan    <-chan Shipyard    // Channel for reading shipyard messages
-	CommodityChan   <-chan Commodity   // Channel for reading commodity messages
-	BlackmarketChan <-chan Blackmarket // Channel for reading blackmarket messages
-	OutfittingChan  <-chan Outfitting  // Channel for reading outfitting messages
-	ControlChan     chan<- int         // Channel providing goroutine control
-	Done            chan bool          // Sent when the ChannelInterface is done.
+	JournalChan     <-chan Journal         // Channel for journal messages. (Provides many message types.)
+	ShipyardChan    <-chan Shipyard        // Channel for reading shipyard messages
+	CommodityChan   <-chan Commodity       // Channel for reading commodity messages
+	BlackmarketChan <-chan Blackmarket     // Channel for reading blackmarket messages
+	OutfittingChan  <-chan Outfitting      // Channel for reading outfitting messages
+	Errors          <-chan error           // Channel for reading receive and decode errors
+	States          <-chan ConnectionEvent // Channel for reading connection state changes
+	Done            <-chan struct{}        // Closed when the ChannelInterface is done.
+
+	cancel  context.CancelFunc // Stops the receiving goroutine
+	dropped *dropCounter       // Messages discarded by backpressure
+}
+
+// channelSet holds the sending side of every channel in a ChannelInterface.
+type channelSet struct {
+	journal     chan Journal
+	shipyard    chan Shipyard
+	commodity   chan Commodity
+	blackmarket chan Blackmarket
+	outfitting  chan Outfitting
+	errors      chan error
+	done        chan struct{}
+	outlets     map[string]*outlet // Buffers for each channel, by stream
 }
 
 // NewChannelInterface creates an active ChannelInterface using the provided
@@ -56,108 +89,258 @@ type ChannelInterface struct {
 // Should the receiver wish to begin receiving messages again then a new
 // ChannelInterface must be created.
 func NewChannelInterface(filter int) (channels *ChannelInterface, err error) {
+	return NewChannelInterfaceWithOptions(filter, DefaultChannelOptions())
+}
+
+// NewChannelInterfaceWithOptions behaves like NewChannelInterface, but
+// connects to the relays, and uses the socket settings, given in opts rather
+// than the defaults.
+func NewChannelInterfaceWithOptions(filter int,
+	opts ChannelOptions) (channels *ChannelInterface, err error) {
+	return NewChannelInterfaceContext(context.Background(), filter, opts)
+}
+
+// NewChannelInterfaceContext behaves like NewChannelInterfaceWithOptions, but
+// the returned ChannelInterface also stops when ctx is cancelled.  Shutdown
+// is prompt even on a quiet feed; the socket is closed and every channel is
+// closed before Done is.
+func NewChannelInterfaceContext(ctx context.Context, filter int,
+	opts ChannelOptions) (channels *ChannelInterface, err error) {
+
+	if err = opts.prepareValidation(); err != nil {
+		return nil, err
+	}
+
+	set := &channelSet{
+		journal:     make(chan Journal),
+		shipyard:    make(chan Shipyard),
+		commodity:   make(chan Commodity),
+		blackmarket: make(chan Blackmarket),
+		outfitting:  make(chan Outfitting),
+		errors:      make(chan error, errorBufferSize),
+		done:        make(chan struct{}),
+		outlets:     make(map[string]*outlet),
+	}
+
+	dropped := newDropCounter()
 
-	subscriber, err := zmq.NewSocket(zmq.SUB)
+	for _, stream := range []string{StreamJournal, StreamShipyard,
+		StreamCommodity, StreamBlackmarket, StreamOutfitting} {
+
+		o, err := newOutlet(&opts, stream, dropped,
+			func(ctx context.Context, d delivery) bool {
+				return set.send(ctx, d.msg)
+			})
+
+		if err != nil {
+			set.closeOutlets()
+			return nil, err
+		}
+
+		set.outlets[stream] = o
+	}
+
+	conn, err := newConnection(&opts, set.errors)
 
 	if err != nil {
+		set.closeOutlets()
 		return nil, err
 	}
 
-	subscriber.Connect(EDDNSubAddress)
-	subscriber.SetSubscribe("")
-	subscriber.SetConnectTimeout(time.Duration(600000))
-	subscriber.SetHeartbeatIvl(500 * time.Millisecond)
-	subscriber.SetTcpKeepalive(1)
-
-	journalChan := make(chan Journal)
-	shipyardChan := make(chan Shipyard)
-	commodityChan := make(chan Commodity)
-	blackmarketChan := make(chan Blackmarket)
-	outfittingChan := make(chan Outfitting)
-	controlChan := make(chan int, 1)
-	Done := make(chan bool)
-
-	go func() {
-		defer close(journalChan)
-		defer close(shipyardChan)
-		defer close(commodityChan)
-		defer close(blackmarketChan)
-		defer close(outfittingChan)
-		defer close(controlChan)
-		defer close(Done)
-
-		for {
-			// Check if we have any control messages first.
-			select {
-			case control := <-controlChan:
-				switch control {
-				case channelInterfaceClose:
-					Done <- true
-					return
-				}
-			default:
-				// NOOP
-			}
+	ctx, cancel := context.WithCancel(ctx)
 
-			eddnData, err := subscriber.Recv(0)
+	go set.run(ctx, conn, filter, &opts)
 
-			if err != nil {
-				fmt.Printf("Error: %v", err)
-				log.Fatalln(err)
-				continue
-			}
+	return &ChannelInterface{set.journal, set.shipyard, set.commodity,
+		set.blackmarket, set.outfitting, set.errors, conn.states, set.done,
+		cancel, dropped}, nil
+}
 
-			Message, err := parseJSON(eddnData)
+// run receives from conn until ctx is done, sending everything that passes
+// both filter and opts.Filter to the matching channel.  It owns conn, and
+// closes it and every channel in set on return.
+func (set *channelSet) run(ctx context.Context, conn *connection,
+	filter int, opts *ChannelOptions) {
 
-			if err != nil && err != errUnhandledSchema {
-				fmt.Printf("Error: %v", err)
-				continue
+	defer close(set.done)
+	defer close(set.journal)
+	defer close(set.shipyard)
+	defer close(set.commodity)
+	defer close(set.blackmarket)
+	defer close(set.outfitting)
+	defer close(set.errors)
+	defer close(conn.states)
+	defer conn.close()
+
+	var wg sync.WaitGroup
+
+	for _, o := range set.outlets {
+		o.start(ctx, &wg)
+	}
+
+	defer set.closeOutlets()
+	defer wg.Wait()
+
+	receiveLoop(ctx, conn, set.errors, All(MaskFilter(filter), opts.Filter),
+		opts, func(d delivery) bool {
+			o, ok := set.outlets[streamOf(d.msg)]
+
+			// Schemas registered by the application have no channel here, and
+			// are only delivered by an EventStream.
+			if !ok {
+				return true
 			}
 
-			switch Message.(type) {
-			case Journal:
+			return o.push(ctx, d)
+		})
+}
+
+// closeOutlets releases the resources held by every outlet in set.
+func (set *channelSet) closeOutlets() {
+	for _, o := range set.outlets {
+		o.close()
+	}
+}
 
-				if filter&FilterJournal == 0 {
-					journalChan <- Message.(Journal)
-				}
+// streamOf returns the name of the stream msg is sent on, or "" if it has
+// no channel of its own.
+func streamOf(msg interface{}) string {
+	switch msg.(type) {
+	case Journal:
+		return StreamJournal
+	case Shipyard:
+		return StreamShipyard
+	case Commodity:
+		return StreamCommodity
+	case Blackmarket:
+		return StreamBlackmarket
+	case Outfitting:
+		return StreamOutfitting
+	}
 
-			case Shipyard:
+	return ""
+}
+
+// receiveLoop receives, and decodes according to opts, messages from conn
+// until ctx is done or deliver returns false.  Only messages accepted by
+// wanted are decoded and delivered.  Errors are reported on errs, and the
+// relay is reconnected to whenever it is lost.
+func receiveLoop(ctx context.Context, conn *connection, errs chan<- error,
+	wanted Filter, opts *ChannelOptions,
+	deliver func(d delivery) bool) {
+
+	for ctx.Err() == nil {
+		eddnData, err := conn.receive(ctx)
+
+		if ctx.Err() != nil {
+			return
+		}
 
-				if filter&FilterShipyard == 0 {
-					shipyardChan <- Message.(Shipyard)
-				}
+		if err != nil {
+			if err != errIdleTimeout && err != errDisconnected {
+				report(errs, &MessageError{Kind: ErrorTransport, Err: err})
+			}
 
-			case Commodity:
+			if conn.reconnect(ctx, err) != nil {
+				return
+			}
 
-				if filter&FilterCommodity == 0 {
-					commodityChan <- Message.(Commodity)
-				}
+			continue
+		}
 
-			case Blackmarket:
+		receivedAt := time.Now()
+		Message, err := parseJSON(eddnData, wanted, opts.registry(),
+			opts.DeliverTest, opts.Validation)
 
-				if filter&FilterBlackmarket == 0 {
-					blackmarketChan <- Message.(Blackmarket)
-				}
+		if err == errFiltered || errors.Is(err, ErrTestSchema) {
+			continue
+		}
 
-			case Outfitting:
+		var invalid []string
 
-				if filter&FilterOutfitting == 0 {
-					outfittingChan <- Message.(Outfitting)
-				}
+		if err != nil {
+			report(errs, err)
 
-			default:
-				// Probably an invalid, or test schema.  Silently disregard.
+			// Messages flagged as invalid, or with fields that could not be
+			// decoded, are delivered all the same.
+			if Message == nil {
 				continue
 			}
+
+			var validationErr *ValidationError
+
+			if errors.As(err, &validationErr) {
+				invalid = validationErr.Errors
+			}
+		}
+
+		if !deliver(delivery{Message, receivedAt, invalid}) {
+			return
 		}
-	}()
+	}
+}
+
+// send delivers msg to its channel.  It gives up, returning false, if ctx
+// is cancelled while waiting on the receiver.
+func (set *channelSet) send(ctx context.Context, msg interface{}) bool {
+	switch msg := msg.(type) {
+	case Journal:
+		select {
+		case set.journal <- msg:
+		case <-ctx.Done():
+			return false
+		}
+
+	case Shipyard:
+		select {
+		case set.shipyard <- msg:
+		case <-ctx.Done():
+			return false
+		}
+
+	case Commodity:
+		select {
+		case set.commodity <- msg:
+		case <-ctx.Done():
+			return false
+		}
+
+	case Blackmarket:
+		select {
+		case set.blackmarket <- msg:
+		case <-ctx.Done():
+			return false
+		}
+
+	case Outfitting:
+		select {
+		case set.outfitting <- msg:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// report passes err on to the receiver, discarding it if the errs buffer
+// is full so a receiver that ignores errors never stalls the subscriber.
+func report(errs chan<- error, err error) {
+	select {
+	case errs <- err:
+	default:
+	}
+}
 
-	return &ChannelInterface{subscriber, journalChan, shipyardChan,
-		commodityChan, blackmarketChan,
-		outfittingChan, controlChan, Done}, nil
+// Dropped returns the number of messages discarded by the backpressure
+// policy, keyed by $schemaRef.
+func (ci *ChannelInterface) Dropped() map[string]uint64 {
+	return ci.dropped.snapshot()
 }
 
-// Close closes the given ChannelInterface ci.
+// Close stops the given ChannelInterface ci and waits until its socket and
+// channels have been closed.  It is safe to call Close more than once.
 func (ci *ChannelInterface) Close() {
-	ci.ControlChan <- channelInterfaceClose
+	ci.cancel()
+	<-ci.Done
 }
@@ -0,0 +1,166 @@
+package EDDNClient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testJournalPayload returns a compressed journal message from the test
+// feed, as a relay would send it.
+func testJournalPayload(t *testing.T) string {
+	for _, data := range loadFeed(t) {
+		msg, err := parseJSON(data, nil, defaultRegistry, false, ValidationOff)
+
+		if _, ok := msg.(Journal); ok && err == nil {
+			return data
+		}
+	}
+
+	t.Fatal("no journal message in the test feed")
+
+	return ""
+}
+
+// allClosed reports whether every channel in chans is closed, discarding
+// anything still buffered in them.
+func allClosed(chans ...interface{}) bool {
+	for _, ch := range chans {
+		for {
+			value, ok := reflect.ValueOf(ch).TryRecv()
+
+			// Nothing is waiting, and the channel is still open.
+			if !value.IsValid() {
+				return false
+			}
+
+			if !ok {
+				break
+			}
+		}
+	}
+
+	return true
+}
+
+// channelsOf returns every channel in ci.
+func channelsOf(ci *ChannelInterface) []interface{} {
+	return []interface{}{ci.JournalChan, ci.ShipyardChan, ci.CommodityChan,
+		ci.BlackmarketChan, ci.OutfittingChan, ci.Errors, ci.States, ci.Done}
+}
+
+func TestChannelInterfaceClose(t *testing.T) {
+	payload := testJournalPayload(t)
+	relays := newTestRelays()
+
+	ci, err := NewChannelInterfaceWithOptions(FilterNone,
+		relays.options("tcp://127.0.0.1:9500"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go relays.send(payload)
+
+	if msg := <-ci.JournalChan; msg.SchemaRef == "" {
+		t.Errorf("got journal message %+v", msg)
+	}
+
+	// Close stops the subscriber even while it waits on a receiver, and is
+	// safe to call again.
+	relays.send(payload)
+
+	ci.Close()
+	ci.Close()
+
+	if !allClosed(channelsOf(ci)...) || relays.openRelays() != 0 {
+		t.Errorf("channels, and %d relays, left open by Close",
+			relays.openRelays())
+	}
+}
+
+func TestChannelInterfaceCancel(t *testing.T) {
+	relays := newTestRelays()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ci, err := NewChannelInterfaceContext(ctx, FilterNone,
+		relays.options("tcp://127.0.0.1:9500"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	<-ci.Done
+
+	if !allClosed(channelsOf(ci)...) || relays.openRelays() != 0 {
+		t.Errorf("channels, and %d relays, left open once cancelled",
+			relays.openRelays())
+	}
+
+	ci.Close()
+}
+
+func TestChannelInterfaceErrors(t *testing.T) {
+	relays := newTestRelays()
+	opts := relays.options("tcp://127.0.0.1:9500", "tcp://127.0.0.1:9501")
+	opts.ReconnectBackoff = time.Millisecond
+
+	ci, err := NewChannelInterfaceWithOptions(FilterNone, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ci.Close()
+
+	// A message that can't be decoded is reported, with its payload...
+	relays.send("garbage")
+
+	var msgErr *MessageError
+
+	if err = <-ci.Errors; !errors.As(err, &msgErr) ||
+		msgErr.Kind != ErrorDecompress || string(msgErr.Payload) != "garbage" {
+		t.Errorf("got %v for an undecodable message", err)
+	}
+
+	// ...as is the socket failing, after which the next relay is used.
+	failure := errors.New("socket failed")
+	relays.steps <- testStep{err: failure}
+
+	if err = <-ci.Errors; !errors.As(err, &msgErr) ||
+		msgErr.Kind != ErrorTransport || !errors.Is(err, failure) {
+		t.Errorf("got %v for a failed socket", err)
+	}
+
+	// Messages with fields that can't be decoded are reported, and delivered.
+	go relays.send(compress([]byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0"},` +
+		`"message":{"event":"FSDJump","timestamp":"yesterday","StarSystem":"Sol",` +
+		`"StarPos":[0,0,0],"SystemAddress":10477373803}}`)))
+
+	if err = <-ci.Errors; !errors.As(err, &msgErr) || msgErr.Kind != ErrorField {
+		t.Errorf("got %v for an undecodable timestamp", err)
+	}
+
+	if msg := <-ci.JournalChan; msg.Message.(JournalFSDJump).StarSystem != "Sol" {
+		t.Errorf("got journal message %+v with an undecodable timestamp", msg)
+	}
+
+	// Receiving carries on regardless.
+	payload := testJournalPayload(t)
+	go relays.send(payload)
+
+	if msg := <-ci.JournalChan; msg.SchemaRef == "" {
+		t.Errorf("got journal message %+v after the errors", msg)
+	}
+
+	relays.mu.Lock()
+	defer relays.mu.Unlock()
+
+	if len(relays.dialled) != 2 || relays.dialled[1] != opts.RelayAddresses[1] {
+		t.Errorf("dialled %v after the socket failed", relays.dialled)
+	}
+}
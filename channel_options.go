@@ -0,0 +1,182 @@
+package EDDNClient
+
+import (
+	zmq "github.com/pebbe/zmq4"
+	"time"
+)
+
+// ChannelOptions describes how a ChannelInterface connects to, and receives
+// from, the EDDN relay.  The zero value of any socket setting leaves the
+// matching ZeroMQ option at its library default; DefaultChannelOptions
+// returns the settings used by NewChannelInterface.
+//
+// Only one relay is used at a time.  The first in RelayAddresses is tried
+// first, and whenever the relay disconnects, or sends nothing for
+// IdleTimeout, the next one is tried after waiting ReconnectBackoff.  The
+// wait doubles after every attempt up to MaxReconnectBackoff, and is reset
+// once a connection succeeds.
+type ChannelOptions struct {
+	RelayAddresses       []string      // Relays to connect to, in order.  Required.
+	IdleTimeout          time.Duration // Reconnect after this long without data.  Zero disables.
+	ReconnectBackoff     time.Duration // Initial wait between reconnects.  Defaults to 1s.
+	MaxReconnectBackoff  time.Duration // Longest wait between reconnects.  Defaults to 1m.
+	ConnectTimeout       time.Duration // Timeout for each connection attempt
+	HeartbeatInterval    time.Duration // Interval between ZMTP heartbeats
+	ReceiveTimeout       time.Duration // Longest a single wait for data blocks before checking whether to stop.  Defaults to 250ms.
+	ReceiveHighWaterMark int           // Messages queued by ZeroMQ before dropping
+	TCPKeepalive         bool          // Enable TCP keepalive on the connection
+	TCPKeepaliveIdle     int           // Seconds idle before keepalive probes start
+	TCPKeepaliveInterval int           // Seconds between keepalive probes
+	TCPKeepaliveCount    int           // Unanswered probes before the link is dead
+
+	Backpressure   BackpressurePolicy // What to do when a receiver falls behind
+	BufferSize     int                // Messages buffered for each channel
+	StreamBuffers  map[string]int     // BufferSize for individual channels, by Stream* name
+	SpillDirectory string             // Where PolicySpillToDisk queues.  Defaults to os.TempDir().
+
+	Filter      Filter          // Only messages matched are received, as well as passing the bitmask filter
+	Registry    *SchemaRegistry // Schemas decoded.  Defaults to NewSchemaRegistry's.
+	DeliverTest bool            // Receive messages using the /test schemas, which are otherwise dropped
+	Validation  ValidationMode  // Whether messages are checked against the JSON Schema for their $schemaRef
+
+	dial dialFunc // Connects to each relay.  Defaults to dialZMQ; replaced by tests.
+}
+
+// ValidationMode decides whether received messages are validated against
+// the JSON Schema for their $schemaRef, and what happens to those that fail.
+// Either way, every invalid message is reported on Errors as a MessageError
+// of kind ErrorValidation, wrapping a *ValidationError.  A journal event that
+// the bundled schema doesn't list isn't invalid for that alone, as the
+// gateway has already accepted it.
+type ValidationMode int
+
+// The available validation modes.
+const (
+	ValidationOff  ValidationMode = iota // Messages are not validated
+	ValidationDrop                       // Invalid messages are discarded
+	ValidationFlag                       // Invalid messages are delivered, marked by Event.ValidationErrors
+)
+
+// DefaultChannelOptions returns the options used by NewChannelInterface.  It
+// is a good starting point for callers that only wish to change a few of
+// them, such as pointing RelayAddresses at a local test relay.
+func DefaultChannelOptions() ChannelOptions {
+	return ChannelOptions{
+		RelayAddresses:      []string{EDDNSubAddress},
+		IdleTimeout:         2 * time.Minute,
+		ReconnectBackoff:    defaultReconnectBackoff,
+		MaxReconnectBackoff: defaultMaxReconnectBackoff,
+		ConnectTimeout:      10 * time.Second,
+		HeartbeatInterval:   500 * time.Millisecond,
+		TCPKeepalive:        true,
+	}
+}
+
+// receiveTimeout returns how long each wait for data may block.
+func (opts *ChannelOptions) receiveTimeout() time.Duration {
+	if opts.ReceiveTimeout <= 0 {
+		return pollInterval
+	}
+
+	return opts.ReceiveTimeout
+}
+
+// registry returns the SchemaRegistry messages are decoded with.
+func (opts *ChannelOptions) registry() *SchemaRegistry {
+	if opts.Registry == nil {
+		return defaultRegistry
+	}
+
+	return opts.Registry
+}
+
+// prepareValidation loads the JSON Schema of every schema in the registry,
+// if messages are to be validated, so that missing schemas are reported
+// before anything is received.
+func (opts *ChannelOptions) prepareValidation() (err error) {
+	if opts.Validation == ValidationOff {
+		return nil
+	}
+
+	registry := opts.registry()
+
+	for _, def := range registry.Schemas() {
+		if _, err = registry.validator(def); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newSubscriberSocket creates a SUB socket configured according to opts and
+// connected to the relay at address.
+func newSubscriberSocket(opts *ChannelOptions,
+	address string) (subscriber *zmq.Socket, err error) {
+
+	subscriber, err = zmq.NewSocket(zmq.SUB)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applySocketOptions(subscriber, opts); err != nil {
+		subscriber.Close()
+		return nil, err
+	}
+
+	if err = subscriber.Connect(address); err != nil {
+		subscriber.Close()
+		return nil, err
+	}
+
+	if err = subscriber.SetSubscribe(""); err != nil {
+		subscriber.Close()
+		return nil, err
+	}
+
+	return subscriber, nil
+}
+
+// applySocketOptions sets every non-zero option in opts on socket.  These
+// must be applied before connecting for most of them to take effect.
+func applySocketOptions(socket *zmq.Socket, opts *ChannelOptions) (err error) {
+	set := func(apply func() error) {
+		if err == nil {
+			err = apply()
+		}
+	}
+
+	// Never block closing the socket on undelivered data; we only receive.
+	set(func() error { return socket.SetLinger(0) })
+
+	if opts.ConnectTimeout > 0 {
+		set(func() error { return socket.SetConnectTimeout(opts.ConnectTimeout) })
+	}
+
+	if opts.HeartbeatInterval > 0 {
+		set(func() error { return socket.SetHeartbeatIvl(opts.HeartbeatInterval) })
+	}
+
+	if opts.ReceiveHighWaterMark > 0 {
+		set(func() error { return socket.SetRcvhwm(opts.ReceiveHighWaterMark) })
+	}
+
+	if opts.TCPKeepalive {
+		set(func() error { return socket.SetTcpKeepalive(1) })
+
+		if opts.TCPKeepaliveIdle > 0 {
+			set(func() error { return socket.SetTcpKeepaliveIdle(opts.TCPKeepaliveIdle) })
+		}
+
+		if opts.TCPKeepaliveInterval > 0 {
+			set(func() error { return socket.SetTcpKeepaliveIntvl(opts.TCPKeepaliveInterval) })
+		}
+
+		if opts.TCPKeepaliveCount > 0 {
+			set(func() error { return socket.SetTcpKeepaliveCnt(opts.TCPKeepaliveCount) })
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,94 @@
+package EDDNClient
+
+import (
+	zmq "github.com/pebbe/zmq4"
+	"testing"
+	"time"
+)
+
+// socketSettings holds the options applySocketOptions sets, as read back
+// from a socket.
+type socketSettings struct {
+	linger, connectTimeout, heartbeat                              time.Duration
+	rcvhwm, keepalive, keepaliveIdle, keepaliveIntvl, keepaliveCnt int
+}
+
+func readSocketSettings(t *testing.T, socket *zmq.Socket) (settings socketSettings) {
+	get := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var err error
+
+	settings.linger, err = socket.GetLinger()
+	get(err)
+	settings.connectTimeout, err = socket.GetConnectTimeout()
+	get(err)
+	settings.heartbeat, err = socket.GetHeartbeatIvl()
+	get(err)
+	settings.rcvhwm, err = socket.GetRcvhwm()
+	get(err)
+	settings.keepalive, err = socket.GetTcpKeepalive()
+	get(err)
+	settings.keepaliveIdle, err = socket.GetTcpKeepaliveIdle()
+	get(err)
+	settings.keepaliveIntvl, err = socket.GetTcpKeepaliveIntvl()
+	get(err)
+	settings.keepaliveCnt, err = socket.GetTcpKeepaliveCnt()
+	get(err)
+
+	return settings
+}
+
+func TestApplySocketOptions(t *testing.T) {
+	newSocket := func() *zmq.Socket {
+		socket, err := zmq.NewSocket(zmq.SUB)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return socket
+	}
+
+	// The zero value leaves everything but the linger at its default.
+	defaults := newSocket()
+	defer defaults.Close()
+
+	want := readSocketSettings(t, defaults)
+	want.linger = 0
+
+	socket := newSocket()
+	defer socket.Close()
+
+	if err := applySocketOptions(socket, &ChannelOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readSocketSettings(t, socket); got != want {
+		t.Errorf("zero options: got %+v, want %+v", got, want)
+	}
+
+	// Everything given is set.
+	opts := DefaultChannelOptions()
+	opts.ReceiveHighWaterMark = 5000
+	opts.TCPKeepaliveIdle = 60
+	opts.TCPKeepaliveInterval = 10
+	opts.TCPKeepaliveCount = 3
+
+	socket = newSocket()
+	defer socket.Close()
+
+	if err := applySocketOptions(socket, &opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want = socketSettings{0, 10 * time.Second, 500 * time.Millisecond,
+		5000, 1, 60, 10, 3}
+
+	if got := readSocketSettings(t, socket); got != want {
+		t.Errorf("default options: got %+v, want %+v", got, want)
+	}
+}
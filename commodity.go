@@ -11,6 +11,7 @@ type Commodities struct {
 	StatusFlags   []string `json:"statusFlags,omitempty"`
 	Stock         int      `json:"stock"`
 	StockBracket  int      `json:"stockBracket"`
+	Extras                 // Fields not otherwise decoded, see Extras
 }
 
 // CommodityMessage contains the commodity data sent to EDDN.
@@ -18,12 +19,18 @@ type CommodityMessage struct {
 	Commodities []Commodities `json:"commodities"` // Required
 	StationName string        `json:"stationName"` // Required
 	SystemName  string        `json:"systemName"`  // Required
-	Timestamp   string        `json:"timestamp"`   // Required
+	Timestamp   Timestamp     `json:"timestamp"`   // Required
+	Extras                    // Fields not otherwise decoded, see Extras
 }
 
 // Commodity is the high level type that contains the entire JSON message.
+// Messages received using the legacy commodity/1 and commodity/2 schemas are
+// upgraded to this one, and record the version they were sent as in
+// SourceVersion.
 type Commodity struct {
-	SchemaRef string           `json:"$schemaRef"`
-	Header    Header           `json:"header"`
-	Message   CommodityMessage `json:"message"`
+	SchemaRef     string           `json:"$schemaRef"`
+	Header        Header           `json:"header"`
+	Message       CommodityMessage `json:"message"`
+	Extras                         // Fields not otherwise decoded, see Extras
+	SourceVersion string           `json:"-"` // Version upgraded from, if received as a legacy schema
 }
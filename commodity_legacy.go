@@ -0,0 +1,153 @@
+package EDDNClient
+
+// CommodityV1Message is the message body of the commodity/1 schema, which
+// carried a single commodity per message.
+type CommodityV1Message struct {
+	BuyPrice     int       `json:"buyPrice"`
+	Demand       int       `json:"demand"`
+	DemandLevel  string    `json:"demandLevel"` // "Low", "Med", or "High"
+	ItemName     string    `json:"itemName"`
+	SellPrice    int       `json:"sellPrice"`
+	StationName  string    `json:"stationName"`
+	StationStock int       `json:"stationStock"`
+	SupplyLevel  string    `json:"supplyLevel"` // "Low", "Med", or "High"
+	SystemName   string    `json:"systemName"`
+	Timestamp    Timestamp `json:"timestamp"`
+	Extras                 // Fields not otherwise decoded, see Extras
+}
+
+// CommodityV1 is a whole commodity/1 message.
+type CommodityV1 struct {
+	SchemaRef string             `json:"$schemaRef"`
+	Header    Header             `json:"header"`
+	Message   CommodityV1Message `json:"message"`
+	Extras                       // Fields not otherwise decoded, see Extras
+}
+
+// CommoditiesV2 describes a single commodity in a CommodityV2Message.
+type CommoditiesV2 struct {
+	BuyPrice    int    `json:"buyPrice"`
+	Demand      int    `json:"demand"`
+	DemandLevel string `json:"demandLevel"` // "Low", "Med", or "High"
+	Name        string `json:"name"`
+	SellPrice   int    `json:"sellPrice"`
+	Supply      int    `json:"supply"`
+	SupplyLevel string `json:"supplyLevel"` // "Low", "Med", or "High"
+	Extras             // Fields not otherwise decoded, see Extras
+}
+
+// CommodityV2Message is the message body of the commodity/2 schema.
+type CommodityV2Message struct {
+	Commodities []CommoditiesV2 `json:"commodities"`
+	StationName string          `json:"stationName"`
+	SystemName  string          `json:"systemName"`
+	Timestamp   Timestamp       `json:"timestamp"`
+	Extras                      // Fields not otherwise decoded, see Extras
+}
+
+// CommodityV2 is a whole commodity/2 message.
+type CommodityV2 struct {
+	SchemaRef string             `json:"$schemaRef"`
+	Header    Header             `json:"header"`
+	Message   CommodityV2Message `json:"message"`
+	Extras                       // Fields not otherwise decoded, see Extras
+}
+
+// commodityV3URI is the $schemaRef of the current commodity schema, which
+// legacy messages are upgraded to.
+const commodityV3URI = "http://schemas.elite-markets.net/eddn/commodity/3"
+
+// levelBrackets maps the supply and demand levels of the legacy schemas to
+// the brackets used by the current one.
+var levelBrackets = map[string]int{
+	"":     0,
+	"Low":  1,
+	"Med":  2,
+	"High": 3,
+}
+
+// Upgrade converts msg to the current commodity schema.  The result has
+// SourceVersion "1"; MeanPrice and StatusFlags, which didn't exist then, are
+// left empty.  The message's Extra fields are kept in those of the result.
+func (msg CommodityV1) Upgrade() Commodity {
+	return Commodity{
+		SchemaRef: commodityV3URI,
+		Header:    msg.Header,
+		Extras:    Extras{Extra: msg.Extra},
+		Message: CommodityMessage{
+			Commodities: []Commodities{{
+				BuyPrice:      msg.Message.BuyPrice,
+				Demand:        msg.Message.Demand,
+				DemandBracket: levelBrackets[msg.Message.DemandLevel],
+				Name:          msg.Message.ItemName,
+				SellPrice:     msg.Message.SellPrice,
+				Stock:         msg.Message.StationStock,
+				StockBracket:  levelBrackets[msg.Message.SupplyLevel],
+			}},
+			StationName: msg.Message.StationName,
+			SystemName:  msg.Message.SystemName,
+			Timestamp:   msg.Message.Timestamp,
+			Extras:      Extras{Extra: msg.Message.Extra},
+		},
+		SourceVersion: "1",
+	}
+}
+
+// Upgrade converts msg to the current commodity schema.  The result has
+// SourceVersion "2"; MeanPrice and StatusFlags, which didn't exist then, are
+// left empty.  The Extra fields of the message, and of each commodity, are
+// kept in those of the result.
+func (msg CommodityV2) Upgrade() Commodity {
+	commodities := make([]Commodities, len(msg.Message.Commodities))
+
+	for i, commodity := range msg.Message.Commodities {
+		commodities[i] = Commodities{
+			BuyPrice:      commodity.BuyPrice,
+			Demand:        commodity.Demand,
+			DemandBracket: levelBrackets[commodity.DemandLevel],
+			Name:          commodity.Name,
+			SellPrice:     commodity.SellPrice,
+			Stock:         commodity.Supply,
+			StockBracket:  levelBrackets[commodity.SupplyLevel],
+			Extras:        Extras{Extra: commodity.Extra},
+		}
+	}
+
+	return Commodity{
+		SchemaRef: commodityV3URI,
+		Header:    msg.Header,
+		Extras:    Extras{Extra: msg.Extra},
+		Message: CommodityMessage{
+			Commodities: commodities,
+			StationName: msg.Message.StationName,
+			SystemName:  msg.Message.SystemName,
+			Timestamp:   msg.Message.Timestamp,
+			Extras:      Extras{Extra: msg.Message.Extra},
+		},
+		SourceVersion: "2",
+	}
+}
+
+// decodeCommodityV1 is the SchemaDefinition.Decode for commodity/1, which
+// delivers the message upgraded to a Commodity.
+func decodeCommodityV1(data []byte) (msg interface{}, err error) {
+	var legacy CommodityV1
+
+	if err = decodeExtras(data, &legacy); decodeFailed(err) {
+		return nil, err
+	}
+
+	return legacy.Upgrade(), err
+}
+
+// decodeCommodityV2 is the SchemaDefinition.Decode for commodity/2, which
+// delivers the message upgraded to a Commodity.
+func decodeCommodityV2(data []byte) (msg interface{}, err error) {
+	var legacy CommodityV2
+
+	if err = decodeExtras(data, &legacy); decodeFailed(err) {
+		return nil, err
+	}
+
+	return legacy.Upgrade(), err
+}
@@ -0,0 +1,386 @@
+package EDDNClient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	zmq "github.com/pebbe/zmq4"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ConnectionState describes the health of the connection to the relay.
+type ConnectionState int
+
+// The states reported in a ConnectionEvent.
+const (
+	StateConnected    ConnectionState = iota // Connected to a relay
+	StateDisconnected                        // Lost the relay, it went silent, or it couldn't be reached
+	StateReconnecting                        // Waiting to try the next relay
+)
+
+var connectionStateNames = map[ConnectionState]string{
+	StateConnected:    "connected",
+	StateDisconnected: "disconnected",
+	StateReconnecting: "reconnecting",
+}
+
+// String returns a short, human readable, name for the state.
+func (state ConnectionState) String() string {
+	if name, ok := connectionStateNames[state]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ConnectionState(%d)", int(state))
+}
+
+// ConnectionEvent is sent whenever the connection to the relay changes
+// state.
+type ConnectionEvent struct {
+	State   ConnectionState // The new state
+	Address string          // The relay the state applies to
+	Err     error           // Why the connection was lost, if it was
+	Time    time.Time       // When the change happened
+}
+
+// Backoff used between reconnects when ChannelOptions leaves it unset.
+const (
+	defaultReconnectBackoff    = time.Second
+	defaultMaxReconnectBackoff = time.Minute
+)
+
+// stateBufferSize is the number of ConnectionEvents held for the receiver
+// before any further events are discarded.
+const stateBufferSize = 16
+
+var (
+	errIdleTimeout  = errors.New("no data received within the idle timeout")
+	errDisconnected = errors.New("disconnected from relay")
+)
+
+// monitorCount is used to give every socket monitor a unique address.
+var monitorCount uint64
+
+// relayEvent is what a relay reports from a single wait for data.
+type relayEvent int
+
+// The events returned by relay.next.
+const (
+	relayIdle         relayEvent = iota // Nothing arrived in time
+	relayMessage                        // A message arrived
+	relayConnected                      // The relay was reached
+	relayDisconnected                   // The relay was lost
+)
+
+// relay is the connection to a single EDDN relay.  zmqRelay is the only
+// implementation outside of tests.
+type relay interface {
+	// next waits up to timeout for the relay to send a message, or for the
+	// connection to change, and reports which happened.
+	next(timeout time.Duration) (event relayEvent, data string, err error)
+
+	close()
+}
+
+// dialFunc connects to the relay at address, configured according to opts.
+type dialFunc func(opts *ChannelOptions, address string) (relay, error)
+
+// connection manages the relay for a single ChannelInterface.  It rotates
+// through the configured relays, and backs off between attempts, whenever
+// the current relay is lost.
+type connection struct {
+	opts     *ChannelOptions      // Relays, and socket settings
+	dial     dialFunc             // Connects to each relay
+	index    int                  // Index of the current relay
+	relay    relay                // The current relay, nil when closed
+	lastData time.Time            // When data last arrived, or we connected
+	backoff  time.Duration        // Delay before the next reconnect
+	errs     chan<- error         // Errors for the receiver
+	states   chan ConnectionEvent // Connection events for the receiver
+}
+
+// newConnection creates a connection to the first relay in opts, reporting
+// later failures to connect on errs.  Errors returned here are
+// configuration errors; later failures are handled by reconnecting.
+func newConnection(opts *ChannelOptions, errs chan<- error) (conn *connection,
+	err error) {
+
+	if len(opts.RelayAddresses) == 0 {
+		return nil, errors.New("no relay addresses provided")
+	}
+
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = defaultReconnectBackoff
+	}
+
+	if opts.MaxReconnectBackoff <= 0 {
+		opts.MaxReconnectBackoff = defaultMaxReconnectBackoff
+	}
+
+	if opts.MaxReconnectBackoff < opts.ReconnectBackoff {
+		opts.MaxReconnectBackoff = opts.ReconnectBackoff
+	}
+
+	conn = &connection{
+		opts:    opts,
+		dial:    opts.dial,
+		backoff: opts.ReconnectBackoff,
+		errs:    errs,
+		states:  make(chan ConnectionEvent, stateBufferSize),
+	}
+
+	if conn.dial == nil {
+		conn.dial = dialZMQ
+	}
+
+	if err = conn.open(); err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// address returns the relay currently in use.
+func (conn *connection) address() string {
+	return conn.opts.RelayAddresses[conn.index]
+}
+
+// open connects to the current relay.
+func (conn *connection) open() (err error) {
+	conn.relay, err = conn.dial(conn.opts, conn.address())
+
+	if err != nil {
+		return err
+	}
+
+	conn.lastData = time.Now()
+
+	return nil
+}
+
+// close closes the current relay.  It is safe to call on a connection that
+// is already closed.
+func (conn *connection) close() {
+	if conn.relay != nil {
+		conn.relay.close()
+		conn.relay = nil
+	}
+}
+
+// notify passes a state change on to the receiver, discarding it if the
+// buffer is full.
+func (conn *connection) notify(state ConnectionState, err error) {
+	select {
+	case conn.states <- ConnectionEvent{state, conn.address(), err, time.Now()}:
+	default:
+	}
+}
+
+// receive waits for the next message from the relay.  It returns ctx.Err()
+// once ctx is done, and a transport error if the relay is lost, went
+// silent for longer than the idle timeout, or the socket failed.
+func (conn *connection) receive(ctx context.Context) (data string, err error) {
+	var event relayEvent
+
+	for ctx.Err() == nil {
+		event, data, err = conn.relay.next(conn.opts.receiveTimeout())
+
+		if err != nil {
+			return "", err
+		}
+
+		switch event {
+		case relayMessage:
+			conn.lastData = time.Now()
+			return data, nil
+
+		case relayConnected:
+			conn.connected()
+
+		case relayDisconnected:
+			return "", errDisconnected
+		}
+
+		if conn.opts.IdleTimeout > 0 &&
+			time.Since(conn.lastData) > conn.opts.IdleTimeout {
+			return "", errIdleTimeout
+		}
+	}
+
+	return "", ctx.Err()
+}
+
+// connected resets the backoff, and reports the connection to the receiver,
+// once the current relay has been reached.
+func (conn *connection) connected() {
+	conn.backoff = conn.opts.ReconnectBackoff
+	conn.notify(StateConnected, nil)
+}
+
+// reconnect reports that the current relay was lost because of cause,
+// closes the relay, waits out the backoff, and connects to the next relay
+// in the list.  It keeps trying, doubling the backoff up to its maximum
+// after each failure, until it succeeds or ctx is done.  Each failure is
+// reported on both errs and states.
+func (conn *connection) reconnect(ctx context.Context, cause error) error {
+	conn.notify(StateDisconnected, cause)
+	conn.close()
+
+	for {
+		conn.index = (conn.index + 1) % len(conn.opts.RelayAddresses)
+		conn.notify(StateReconnecting, nil)
+
+		timer := time.NewTimer(conn.backoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		conn.backoff *= 2
+
+		if conn.backoff > conn.opts.MaxReconnectBackoff {
+			conn.backoff = conn.opts.MaxReconnectBackoff
+		}
+
+		err := conn.open()
+
+		if err == nil {
+			return nil
+		}
+
+		err = fmt.Errorf("connect to %s: %w", conn.address(), err)
+		report(conn.errs, &MessageError{Kind: ErrorTransport, Err: err})
+		conn.notify(StateDisconnected, err)
+	}
+}
+
+// zmqRelay is a relay reached over a ZeroMQ SUB socket, with a monitor
+// watching its connection.
+type zmqRelay struct {
+	socket  *zmq.Socket // Subscriber socket
+	monitor *zmq.Socket // Receives events about socket
+	poller  *zmq.Poller // Polls both socket and monitor
+}
+
+// dialZMQ is the dialFunc used outside of tests.  It creates, and connects,
+// the subscriber and its monitor.
+func dialZMQ(opts *ChannelOptions, address string) (r relay, err error) {
+	socket, err := newSubscriberSocket(opts, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	monitorAddress := fmt.Sprintf("inproc://eddnclient-monitor-%d",
+		atomic.AddUint64(&monitorCount, 1))
+
+	err = socket.Monitor(monitorAddress,
+		zmq.EVENT_CONNECTED|zmq.EVENT_DISCONNECTED)
+
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	monitor, err := zmq.NewSocket(zmq.PAIR)
+
+	if err != nil {
+		socket.Close()
+		return nil, err
+	}
+
+	monitor.SetLinger(0)
+
+	if err = monitor.Connect(monitorAddress); err != nil {
+		monitor.Close()
+		socket.Close()
+		return nil, err
+	}
+
+	poller := zmq.NewPoller()
+	poller.Add(socket, zmq.POLLIN)
+	poller.Add(monitor, zmq.POLLIN)
+
+	return &zmqRelay{socket, monitor, poller}, nil
+}
+
+func (r *zmqRelay) next(timeout time.Duration) (event relayEvent, data string,
+	err error) {
+
+	polled, err := r.poller.Poll(timeout)
+
+	if err != nil && zmq.AsErrno(err) == zmq.Errno(syscall.EINTR) {
+		return relayIdle, "", nil
+	}
+
+	if err != nil {
+		return relayIdle, "", err
+	}
+
+	for _, item := range polled {
+		switch item.Socket {
+		case r.monitor:
+			if event, err = r.monitorEvent(); event != relayIdle || err != nil {
+				return event, "", err
+			}
+
+		case r.socket:
+			data, err = r.socket.Recv(zmq.DONTWAIT)
+
+			// Nothing was actually waiting.
+			if err != nil && interrupted(err) {
+				continue
+			}
+
+			if err != nil {
+				return relayIdle, "", err
+			}
+
+			return relayMessage, data, nil
+		}
+	}
+
+	return relayIdle, "", nil
+}
+
+// monitorEvent reads a single event from the monitor.  Failing to read the
+// event is returned as an error, since disconnects can no longer be
+// noticed.
+func (r *zmqRelay) monitorEvent() (event relayEvent, err error) {
+	zmqEvent, _, _, err := r.monitor.RecvEvent(zmq.DONTWAIT)
+
+	// Nothing was actually waiting.
+	if err != nil && interrupted(err) {
+		return relayIdle, nil
+	}
+
+	if err != nil {
+		return relayIdle, fmt.Errorf("socket monitor: %w", err)
+	}
+
+	switch zmqEvent {
+	case zmq.EVENT_CONNECTED:
+		return relayConnected, nil
+
+	case zmq.EVENT_DISCONNECTED:
+		return relayDisconnected, nil
+	}
+
+	return relayIdle, nil
+}
+
+func (r *zmqRelay) close() {
+	r.monitor.Close()
+	r.socket.Close()
+}
+
+// interrupted reports whether err means a non-blocking receive found nothing
+// waiting, or was interrupted, rather than that the socket failed.
+func interrupted(err error) bool {
+	return zmq.AsErrno(err) == zmq.Errno(syscall.EAGAIN) ||
+		zmq.AsErrno(err) == zmq.Errno(syscall.EINTR)
+}
@@ -0,0 +1,292 @@
+package EDDNClient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errRefused = errors.New("connection refused")
+
+// testStep is a single thing a testRelay reports from next.
+type testStep struct {
+	event relayEvent
+	data  string
+	err   error
+}
+
+// testRelays stands in for the relays a connection dials.  Steps sent on
+// steps are reported by whichever relay is open, and dialling any address
+// in refuse fails.
+type testRelays struct {
+	steps  chan testStep
+	refuse map[string]bool
+
+	mu      sync.Mutex
+	dialled []string      // Every address dialled, in order
+	open    int           // Relays dialled, but not yet closed
+	timeout time.Duration // Passed to the latest call to next
+}
+
+func newTestRelays(refuse ...string) *testRelays {
+	relays := &testRelays{steps: make(chan testStep),
+		refuse: make(map[string]bool)}
+
+	for _, address := range refuse {
+		relays.refuse[address] = true
+	}
+
+	return relays
+}
+
+// options returns ChannelOptions connecting to relays at addresses.
+func (relays *testRelays) options(addresses ...string) ChannelOptions {
+	return ChannelOptions{RelayAddresses: addresses, dial: relays.dial}
+}
+
+func (relays *testRelays) dial(opts *ChannelOptions, address string) (relay, error) {
+	relays.mu.Lock()
+	defer relays.mu.Unlock()
+
+	relays.dialled = append(relays.dialled, address)
+
+	if relays.refuse[address] {
+		return nil, errRefused
+	}
+
+	relays.open++
+
+	return &testRelay{relays: relays}, nil
+}
+
+// openRelays returns the number of relays dialled, but not yet closed.
+func (relays *testRelays) openRelays() int {
+	relays.mu.Lock()
+	defer relays.mu.Unlock()
+
+	return relays.open
+}
+
+// send has the open relay send a message with data.
+func (relays *testRelays) send(data string) {
+	relays.steps <- testStep{event: relayMessage, data: data}
+}
+
+// testRelay is a relay dialled by testRelays.
+type testRelay struct {
+	relays *testRelays
+	closed bool
+}
+
+func (r *testRelay) next(timeout time.Duration) (event relayEvent, data string,
+	err error) {
+
+	r.relays.mu.Lock()
+	r.relays.timeout = timeout
+	r.relays.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case step := <-r.relays.steps:
+		return step.event, step.data, step.err
+	case <-timer.C:
+		return relayIdle, "", nil
+	}
+}
+
+func (r *testRelay) close() {
+	r.relays.mu.Lock()
+	defer r.relays.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		r.relays.open--
+	}
+}
+
+func TestConnectionDefaults(t *testing.T) {
+	relays := newTestRelays()
+	opts := relays.options()
+
+	if _, err := newConnection(&opts, nil); err == nil {
+		t.Error("connected without any relay addresses")
+	}
+
+	tests := []struct {
+		backoff, maxBackoff         time.Duration
+		wantBackoff, wantMaxBackoff time.Duration
+	}{
+		{0, 0, defaultReconnectBackoff, defaultMaxReconnectBackoff},
+		{time.Millisecond, 0, time.Millisecond, defaultMaxReconnectBackoff},
+		{2 * time.Minute, time.Minute, 2 * time.Minute, 2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		opts := relays.options("tcp://127.0.0.1:9500")
+		opts.ReconnectBackoff = test.backoff
+		opts.MaxReconnectBackoff = test.maxBackoff
+
+		conn, err := newConnection(&opts, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn.close()
+
+		if opts.ReconnectBackoff != test.wantBackoff ||
+			opts.MaxReconnectBackoff != test.wantMaxBackoff ||
+			conn.backoff != test.wantBackoff {
+			t.Errorf("backoff %v, max %v: got %v, max %v", test.backoff,
+				test.maxBackoff, opts.ReconnectBackoff, opts.MaxReconnectBackoff)
+		}
+	}
+}
+
+func TestConnectionReconnect(t *testing.T) {
+	relays := []string{"tcp://127.0.0.1:9500", "tcp://127.0.0.1:9501",
+		"tcp://127.0.0.1:9502"}
+
+	opts := newTestRelays().options(relays...)
+	opts.ReconnectBackoff = time.Millisecond
+	opts.MaxReconnectBackoff = 4 * time.Millisecond
+
+	conn, err := newConnection(&opts, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.close()
+
+	// Each relay is tried in turn, the backoff doubling up to its maximum.
+	want := []struct {
+		index   int
+		backoff time.Duration
+	}{
+		{1, 2 * time.Millisecond},
+		{2, 4 * time.Millisecond},
+		{0, 4 * time.Millisecond},
+		{1, 4 * time.Millisecond},
+	}
+
+	for _, step := range want {
+		if err = conn.reconnect(context.Background(), errIdleTimeout); err != nil {
+			t.Fatal(err)
+		}
+
+		if conn.index != step.index || conn.backoff != step.backoff {
+			t.Errorf("got relay %d after %v, want relay %d after %v", conn.index,
+				conn.backoff, step.index, step.backoff)
+		}
+
+		lost, next := <-conn.states, <-conn.states
+
+		if lost.State != StateDisconnected || lost.Err != errIdleTimeout ||
+			next.State != StateReconnecting || next.Address != relays[step.index] {
+			t.Errorf("got events %+v, %+v", lost, next)
+		}
+	}
+
+	// Reaching a relay resets the backoff.
+	conn.connected()
+
+	if event := <-conn.states; event.State != StateConnected ||
+		event.Address != relays[1] || conn.backoff != time.Millisecond {
+		t.Errorf("got %+v with backoff %v once connected", event, conn.backoff)
+	}
+
+	// Reconnecting gives up once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err = conn.reconnect(ctx, errDisconnected); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v reconnecting with a cancelled context", err)
+	}
+}
+
+func TestConnectionReconnectFailures(t *testing.T) {
+	relays := newTestRelays("tcp://127.0.0.1:9501")
+	opts := relays.options("tcp://127.0.0.1:9500", "tcp://127.0.0.1:9501",
+		"tcp://127.0.0.1:9502")
+	opts.ReconnectBackoff = time.Millisecond
+
+	errs := make(chan error, 1)
+	conn, err := newConnection(&opts, errs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.close()
+
+	// The relay that can't be reached is reported, and skipped.
+	if err = conn.reconnect(context.Background(), errDisconnected); err != nil {
+		t.Fatal(err)
+	}
+
+	if conn.index != 2 || relays.openRelays() != 1 {
+		t.Errorf("got relay %d, with %d open, after a failure", conn.index,
+			relays.openRelays())
+	}
+
+	var msgErr *MessageError
+
+	if err = <-errs; !errors.As(err, &msgErr) || msgErr.Kind != ErrorTransport ||
+		!errors.Is(err, errRefused) || !strings.Contains(err.Error(), opts.RelayAddresses[1]) {
+		t.Errorf("got error %v for the unreachable relay", err)
+	}
+
+	want := []ConnectionEvent{
+		{State: StateDisconnected, Address: opts.RelayAddresses[0], Err: errDisconnected},
+		{State: StateReconnecting, Address: opts.RelayAddresses[1]},
+		{State: StateDisconnected, Address: opts.RelayAddresses[1], Err: msgErr.Err},
+		{State: StateReconnecting, Address: opts.RelayAddresses[2]},
+	}
+
+	for _, wantEvent := range want {
+		event := <-conn.states
+
+		if event.State != wantEvent.State || event.Address != wantEvent.Address ||
+			event.Err != wantEvent.Err {
+			t.Errorf("got event %+v, want %+v", event, wantEvent)
+		}
+	}
+}
+
+func TestConnectionReceiveTimeout(t *testing.T) {
+	relays := newTestRelays()
+
+	for _, test := range []struct{ timeout, want time.Duration }{
+		{0, pollInterval},
+		{5 * time.Millisecond, 5 * time.Millisecond},
+	} {
+		opts := relays.options("tcp://127.0.0.1:9500")
+		opts.ReceiveTimeout = test.timeout
+
+		conn, err := newConnection(&opts, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go relays.send("data")
+
+		data, err := conn.receive(context.Background())
+		conn.close()
+
+		relays.mu.Lock()
+		timeout := relays.timeout
+		relays.mu.Unlock()
+
+		if data != "data" || err != nil || timeout != test.want {
+			t.Errorf("ReceiveTimeout %v: got %q, %v, waiting %v at a time",
+				test.timeout, data, err, timeout)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package EDDNClient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind identifies the stage at which receiving a message failed.
+type ErrorKind int
+
+// The kinds of errors reported by a MessageError.
+const (
+	ErrorTransport         ErrorKind = iota // Receiving from the relay failed
+	ErrorDecompress                         // The payload was not valid zlib data
+	ErrorJSON                               // The payload was not valid JSON for its schema
+	ErrorUnsupportedSchema                  // The $schemaRef is not one we can decode
+	ErrorJournalDecode                      // The journal event could not be decoded
+	ErrorValidation                         // The payload did not match the JSON Schema for its $schemaRef
+	ErrorField                              // Some fields could not be decoded, and were kept in Extra
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrorTransport:         "transport",
+	ErrorDecompress:        "decompress",
+	ErrorJSON:              "json",
+	ErrorUnsupportedSchema: "unsupported schema",
+	ErrorJournalDecode:     "journal decode",
+	ErrorValidation:        "validation",
+	ErrorField:             "field",
+}
+
+// String returns a short, human readable, name for the kind.
+func (kind ErrorKind) String() string {
+	if name, ok := errorKindNames[kind]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorKind(%d)", int(kind))
+}
+
+var (
+	// ErrTestSchema is wrapped by the error returned when decoding a message
+	// that uses one of the /test schemas.  These are expected on the live
+	// feed, and are silently disregarded by the subscribers unless
+	// ChannelOptions.DeliverTest is set.
+	ErrTestSchema = errors.New("test schema")
+
+	// ErrQueueFull is returned by UploadQueue.Enqueue when as many messages
+	// as the queue holds are already waiting to be sent.
+	ErrQueueFull = errors.New("upload queue full")
+
+	// ErrQueueClosed is returned by UploadQueue.Enqueue once Shutdown has
+	// been called.
+	ErrQueueClosed = errors.New("upload queue closed")
+)
+
+// MessageError describes a single message that could not be received or
+// decoded.  These are sent on a ChannelInterface's Errors channel, and
+// carry the payload so the receiver can log, or store, the offending data.
+type MessageError struct {
+	Kind         ErrorKind // Stage at which the message failed
+	SchemaRef    string    // The $schemaRef of the message, if it was parsed
+	Payload      []byte    // The payload as received from the relay
+	Decompressed []byte    // The decompressed payload, if decompression succeeded
+	Err          error     // The underlying error
+}
+
+// Error implements the error interface.
+func (e *MessageError) Error() string {
+	if e.SchemaRef != "" {
+		return fmt.Sprintf("%v error (%s): %v", e.Kind, e.SchemaRef, e.Err)
+	}
+
+	return fmt.Sprintf("%v error: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying error so that errors.Is and errors.As work
+// through a MessageError.
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists the ways in which a message failed to match the
+// JSON Schema for its $schemaRef.  It is wrapped by a MessageError of kind
+// ErrorValidation.
+type ValidationError struct {
+	Errors []string // Each failure, such as "message.systemName: String length must be greater than or equal to 1"
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return "message does not match its schema: " + strings.Join(e.Errors, "; ")
+}
+
+// FieldError lists the fields of a message that could not be decoded, such
+// as a timestamp in a format ParseTimestamp doesn't know.  Each is left as
+// its zero value and kept, as received, in the Extra of the type holding
+// it.  It is wrapped by a MessageError of kind ErrorField, which is
+// reported along with the message rather than in place of it.
+type FieldError struct {
+	Errors []string // Each field, such as "timestamp: unrecognised timestamp \"yesterday\""
+}
+
+// Error implements the error interface.
+func (e *FieldError) Error() string {
+	return "fields could not be decoded: " + strings.Join(e.Errors, "; ")
+}
+
+// ErrValidation is returned by an Uploader for a message that doesn't match
+// the JSON Schema it would be sent with.  Such messages are never sent.
+type ErrValidation struct {
+	SchemaRef string // The $schemaRef the message would have been sent with
+	Err       error  // The *ValidationError listing the failures
+}
+
+// Error implements the error interface.
+func (e *ErrValidation) Error() string {
+	return fmt.Sprintf("validating %s: %v", e.SchemaRef, e.Err)
+}
+
+// Unwrap returns the underlying *ValidationError.
+func (e *ErrValidation) Unwrap() error {
+	return e.Err
+}
+
+// ErrTransport is returned by an Uploader when a message could not be
+// delivered to the gateway at all, such as when it can't be connected to.
+type ErrTransport struct {
+	Err error // The underlying network error
+}
+
+// Error implements the error interface.
+func (e *ErrTransport) Error() string {
+	return fmt.Sprintf("sending message: %v", e.Err)
+}
+
+// Unwrap returns the underlying network error.
+func (e *ErrTransport) Unwrap() error {
+	return e.Err
+}
+
+// ErrGatewayRejected is returned by an Uploader when the gateway replies to
+// a message with anything but "OK".  A StatusCode of 400 or so means the
+// message itself was refused, such as for not matching its schema, and
+// sending it again won't help.
+type ErrGatewayRejected struct {
+	StatusCode int    // The HTTP status of the reply
+	Body       string // The body of the reply, which describes the problem
+}
+
+// Error implements the error interface.
+func (e *ErrGatewayRejected) Error() string {
+	return fmt.Sprintf("gateway rejected message (%d %s): %s", e.StatusCode,
+		http.StatusText(e.StatusCode), e.Body)
+}
@@ -0,0 +1,146 @@
+package EDDNClient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event is a single message received from EDDN, of any schema.  Payload
+// returns the decoded message itself, which is one of Journal, Shipyard,
+// Commodity, Blackmarket, Outfitting, or the Type of a schema registered with
+// ChannelOptions.Registry, and can be type switched upon.
+type Event interface {
+	Schema() string        // The $schemaRef of the message
+	Header() Header        // The message header
+	ReceivedAt() time.Time // When the message arrived from the relay
+	Payload() interface{}  // The decoded message
+	IsTest() bool          // Whether the message uses a /test schema
+
+	// ValidationErrors returns the ways in which the message failed to match
+	// its JSON Schema, if it was delivered regardless by ValidationFlag.
+	ValidationErrors() []string
+}
+
+// event is the Event implementation sent by an EventStream.
+type event struct {
+	schema     string
+	header     Header
+	receivedAt time.Time
+	payload    interface{}
+	test       bool
+	invalid    []string
+}
+
+func (e *event) Schema() string        { return e.schema }
+func (e *event) Header() Header        { return e.header }
+func (e *event) ReceivedAt() time.Time { return e.receivedAt }
+func (e *event) Payload() interface{}  { return e.payload }
+func (e *event) IsTest() bool          { return e.test }
+
+func (e *event) ValidationErrors() []string { return e.invalid }
+
+// newEvent wraps a delivered message in an Event.
+func newEvent(d delivery) Event {
+	schemaRef, header := messageEnvelope(d.msg)
+
+	return &event{schemaRef, header, d.receivedAt, d.msg,
+		IsTestSchema(schemaRef), d.invalid}
+}
+
+// An EventStream is an alternative to a ChannelInterface that delivers every
+// message on a single channel, Events, in the order it was received.  As
+// there is only the one channel to read, a receiver interested in only a few
+// schemas can't stall the subscriber by leaving other channels unread; it
+// simply discards the Events it doesn't want.
+//
+// Errors, States, Done, and backpressure behave exactly as they do for a
+// ChannelInterface.  Messages using the /test schemas are only received if
+// ChannelOptions.DeliverTest is set, and are marked by Event.IsTest.
+// Likewise, messages delivered despite failing validation are marked by
+// Event.ValidationErrors.  The buffer size for Events is that of
+// StreamEvents.
+type EventStream struct {
+	Events <-chan Event           // Channel for reading every message
+	Errors <-chan error           // Channel for reading receive and decode errors
+	States <-chan ConnectionEvent // Channel for reading connection state changes
+	Done   <-chan struct{}        // Closed when the EventStream is done.
+
+	cancel  context.CancelFunc // Stops the receiving goroutine
+	dropped *dropCounter       // Messages discarded by backpressure
+}
+
+// NewEventStream creates an active EventStream using the provided filter
+// and options, which mean the same as they do for
+// NewChannelInterfaceContext.  The EventStream stops when ctx is cancelled,
+// or Close is called.
+func NewEventStream(ctx context.Context, filter int,
+	opts ChannelOptions) (stream *EventStream, err error) {
+
+	if err = opts.prepareValidation(); err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	errs := make(chan error, errorBufferSize)
+	done := make(chan struct{})
+	dropped := newDropCounter()
+
+	o, err := newOutlet(&opts, StreamEvents, dropped,
+		func(ctx context.Context, d delivery) bool {
+			select {
+			case events <- newEvent(d):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := newConnection(&opts, errs)
+
+	if err != nil {
+		o.close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		defer close(done)
+		defer close(events)
+		defer close(errs)
+		defer close(conn.states)
+		defer conn.close()
+
+		var wg sync.WaitGroup
+
+		o.start(ctx, &wg)
+
+		defer o.close()
+		defer wg.Wait()
+
+		receiveLoop(ctx, conn, errs, All(MaskFilter(filter), opts.Filter),
+			&opts, func(d delivery) bool {
+				return o.push(ctx, d)
+			})
+	}()
+
+	return &EventStream{events, errs, conn.states, done, cancel, dropped}, nil
+}
+
+// Dropped returns the number of messages discarded by the backpressure
+// policy, keyed by $schemaRef.
+func (stream *EventStream) Dropped() map[string]uint64 {
+	return stream.dropped.snapshot()
+}
+
+// Close stops the given EventStream and waits until its socket and channels
+// have been closed.  It is safe to call Close more than once.
+func (stream *EventStream) Close() {
+	stream.cancel()
+	<-stream.Done
+}
@@ -0,0 +1,54 @@
+package EDDNClient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEventStreamClose(t *testing.T) {
+	feed := loadFeed(t)
+	relays := newTestRelays()
+
+	stream, err := NewEventStream(context.Background(), FilterNone,
+		relays.options("tcp://127.0.0.1:9500"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every message arrives on Events, in the order sent.
+	go func() {
+		for _, data := range feed {
+			relays.send(data)
+		}
+	}()
+
+	for _, data := range feed {
+		msg, err := parseJSON(data, nil, defaultRegistry, false, ValidationOff)
+
+		if err != nil {
+			continue
+		}
+
+		event := <-stream.Events
+
+		if schemaRef, _ := messageEnvelope(msg); event.Schema() != schemaRef ||
+			!reflect.DeepEqual(event.Payload(), msg) {
+			t.Fatalf("got %s event, want %s", event.Schema(), schemaRef)
+		}
+	}
+
+	// Close stops the stream even while it waits on a receiver, and is safe
+	// to call again.
+	relays.send(feed[0])
+
+	stream.Close()
+	stream.Close()
+
+	if !allClosed(stream.Events, stream.Errors, stream.States, stream.Done) ||
+		relays.openRelays() != 0 {
+		t.Errorf("channels, and %d relays, left open by Close",
+			relays.openRelays())
+	}
+}
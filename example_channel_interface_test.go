@@ -29,7 +29,4 @@ loop:
 	}
 
 	channelInterface.Close()
-
-	// Output:
-	// Schema: http://schemas.elite-markets.net/eddn/journal/1
 }
@@ -0,0 +1,38 @@
+package EDDNClient_test
+
+import (
+	"context"
+	"fmt"
+	eddn "github.com/mbsmith/EDDNClient"
+	"log"
+	"time"
+)
+
+func ExampleEventStream() {
+	// Receive everything for a minute.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, err := eddn.NewEventStream(ctx, eddn.FilterNone,
+		eddn.DefaultChannelOptions())
+
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Events arrive in order regardless of their schema.  We only care about
+	// commodities and FSD jumps here, so everything else is skipped.
+	for event := range stream.Events {
+		switch msg := event.Payload().(type) {
+		case eddn.Commodity:
+			fmt.Printf("%s: %d commodities\n", msg.Message.StationName,
+				len(msg.Message.Commodities))
+
+		case eddn.Journal:
+			if jump, ok := msg.Message.(eddn.JournalFSDJump); ok {
+				fmt.Printf("%s jumped to %s\n", event.Header().UploaderID,
+					jump.StarSystem)
+			}
+		}
+	}
+}
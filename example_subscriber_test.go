@@ -0,0 +1,33 @@
+package EDDNClient_test
+
+import (
+	"context"
+	"fmt"
+	eddn "github.com/mbsmith/EDDNClient"
+	"log"
+	"time"
+)
+
+func ExampleSubscriber() {
+	subscriber := eddn.NewSubscriber(eddn.FilterNone,
+		eddn.DefaultChannelOptions())
+
+	subscriber.OnJournalFSDJump(func(jump eddn.JournalFSDJump) {
+		fmt.Printf("Jumped to %s\n", jump.StarSystem)
+	})
+
+	subscriber.OnCommodity(func(commodity eddn.Commodity) {
+		fmt.Printf("Market update for %s\n", commodity.Message.StationName)
+	})
+
+	subscriber.OnError(func(err error) {
+		log.Println(err)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := subscriber.Run(ctx); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"log"
 )
 
-func ExampleSendJournalFSDJump() {
+func ExampleUploader_SendJournalFSDJump() {
 	uploader, err := eddn.NewUploader("me", "mysoftware", "1.0")
 
 	if err != nil {
@@ -14,9 +14,9 @@ func ExampleSendJournalFSDJump() {
 
 	journalMsg := &eddn.JournalFSDJump{
 		Event:      "FSDJump",
-		StarPos:    []float64{33.3, 33.4, 33.5},
+		StarPos:    eddn.Vec3{33.3, 33.4, 33.5},
 		StarSystem: "none",
-		Timestamp:  eddn.GenerateUTCDateTime()}
+		Timestamp:  eddn.GenerateUTCTimestamp()}
 
 	err = uploader.SendJournalFSDJump(journalMsg)
 
@@ -27,7 +27,7 @@ func ExampleSendJournalFSDJump() {
 	// Output:
 }
 
-func ExampleSendBlackmarket() {
+func ExampleUploader_SendBlackmarket() {
 	uploader, err := eddn.NewUploader("me", "mysoftware", "1.0")
 
 	if err != nil {
@@ -40,7 +40,7 @@ func ExampleSendBlackmarket() {
 		SellPrice:   1806,
 		SystemName:  "Pleione",
 		StationName: "Stargazer",
-		Timestamp:   eddn.GenerateUTCDateTime()}
+		Timestamp:   eddn.GenerateUTCTimestamp()}
 
 	err = uploader.SendBlackmarket(blackmarketMessage)
 
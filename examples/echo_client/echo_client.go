@@ -39,8 +39,8 @@ func (f *filter) Set(value string) error {
 	}
 
 	for _, ft := range strings.Split(value, ",") {
-		filter := ft
-		*f = append(*f, strings.ToLower(filter))
+		filter := strings.TrimSpace(ft)
+		*f = append(*f, filter)
 	}
 
 	return nil
@@ -48,11 +48,110 @@ func (f *filter) Set(value string) error {
 
 var filterFlag filter
 var prettyPrint = flag.Bool("pretty-print", false, "Pretty print JSON we receive.")
+var testSchemas = flag.Bool("test", false, "Also echo messages sent to the /test schemas.")
+var validate = flag.Bool("validate", false, "Drop messages that don't match their JSON Schema.")
 
 func init() {
 	// Tie the filter flag to filter
 	flag.Var(&filterFlag, "filters",
-		"comma-separated values of results to filter. [outfitting, journal, shipyard, commodity, and blackmarket]")
+		"comma-separated values of results to filter. [outfitting, journal, shipyard, commodity, and blackmarket]\n"+
+			"Messages can also be selected with key=value terms, where key is one of\n"+
+			"schema, event, software, uploader, system, or near (x:y:z:radius).\n"+
+			"Terms with the same key are OR'd together, and different keys AND'd.\n"+
+			"Prefixing a key=value term with - excludes matching messages instead.")
+}
+
+// mask holds the bit for each schema family that may be filtered out.
+var mask = map[string]int{
+	"outfitting":  eddn.FilterOutfitting,
+	"journal":     eddn.FilterJournal,
+	"shipyard":    eddn.FilterShipyard,
+	"commodity":   eddn.FilterCommodity,
+	"blackmarket": eddn.FilterBlackmarket,
+}
+
+// parseTerm builds a Filter from a single key=value filter term.
+func parseTerm(key string, value string) (eddn.Filter, error) {
+	switch key {
+	case "schema":
+		return eddn.Schemas(value), nil
+	case "event":
+		return eddn.Events(value), nil
+	case "software":
+		return eddn.Software(value), nil
+	case "uploader":
+		return eddn.Uploaders(value), nil
+	case "system":
+		return eddn.Systems(value), nil
+	case "near":
+		var center eddn.Vec3
+		var radius float64
+
+		_, err := fmt.Sscanf(value, "%g:%g:%g:%g", &center[0], &center[1],
+			&center[2], &radius)
+
+		if err != nil {
+			return nil, fmt.Errorf("near must be x:y:z:radius: %v", err)
+		}
+
+		return eddn.Within(center, radius), nil
+	}
+
+	return nil, fmt.Errorf("%s is not a valid filter key", key)
+}
+
+// buildFilter turns the filter flag into a bitmask filter, for the plain
+// schema family names, and a Filter for everything else.
+func buildFilter(terms filter) (filters int, composed eddn.Filter) {
+	included := make(map[string][]eddn.Filter)
+	var keys []string
+	var excluded []eddn.Filter
+
+	for _, term := range terms {
+		if bit, ok := mask[strings.ToLower(term)]; ok {
+			filters |= bit
+			continue
+		}
+
+		exclude := strings.HasPrefix(term, "-")
+		kv := strings.SplitN(strings.TrimPrefix(term, "-"), "=", 2)
+
+		if len(kv) != 2 {
+			log.Printf("%s is not a valid filter", term)
+			continue
+		}
+
+		key := strings.ToLower(kv[0])
+		f, err := parseTerm(key, kv[1])
+
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if exclude {
+			excluded = append(excluded, f)
+			continue
+		}
+
+		if _, ok := included[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		included[key] = append(included[key], f)
+	}
+
+	var all []eddn.Filter
+
+	for _, key := range keys {
+		all = append(all, eddn.Any(included[key]...))
+	}
+
+	if len(excluded) > 0 {
+		all = append(all, eddn.Exclude(excluded...))
+	}
+
+	return filters, eddn.All(all...)
 }
 
 func output(data []byte) {
@@ -93,6 +192,15 @@ func handleConnections(channelInterface *eddn.ChannelInterface) {
 		case shipMessage := <-channelInterface.ShipyardChan:
 			b, _ := json.Marshal(shipMessage)
 			output(b)
+
+		case err := <-channelInterface.Errors:
+			log.Println(err)
+
+		case state := <-channelInterface.States:
+			log.Printf("%v: %s\n", state.State, state.Address)
+
+		case <-channelInterface.Done:
+			return
 		}
 	}
 }
@@ -100,31 +208,19 @@ func handleConnections(channelInterface *eddn.ChannelInterface) {
 func main() {
 	flag.Parse()
 
-	var filters int
-
 	// Handle filters if any.
-	for _, filter := range filterFlag {
-
-		switch filter {
-		case "outfitting":
-			filters |= eddn.FilterOutfitting
-		case "journal":
-			filters |= eddn.FilterJournal
-		case "shipyard":
-			filters |= eddn.FilterShipyard
-		case "commodity":
-			filters |= eddn.FilterCommodity
-		case "blackmarket":
-			filters |= eddn.FilterBlackmarket
-		default:
-			log.Printf("%s is not a valid filter", filter)
-			continue
-		}
+	filters, composed := buildFilter(filterFlag)
+
+	opts := eddn.DefaultChannelOptions()
+	opts.Filter = composed
+	opts.DeliverTest = *testSchemas
 
+	if *validate {
+		opts.Validation = eddn.ValidationDrop
 	}
 
 	// Now on to the good stuff.
-	channelInterface, err := eddn.NewChannelInterface(filters)
+	channelInterface, err := eddn.NewChannelInterfaceWithOptions(filters, opts)
 
 	if err != nil {
 		log.Fatalln(err)
@@ -0,0 +1,571 @@
+package EDDNClient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extras is embedded in every message type, and in each type within one.
+// Extra keeps whatever fields of the JSON object the type has no field for,
+// so that messages can be archived, or re-published, without losing
+// anything.  Extras also notes which fields were missing from a decoded
+// message, so that those are left out again when re-marshalled, rather than
+// written as zero values the sender never sent, unless they have been set
+// since.
+//
+// Fields that could not be decoded, such as a timestamp in a format
+// ParseTimestamp doesn't know, are left as their zero value, kept in Extra
+// as received, and reported in a FieldError.  A field left zero is written
+// out from Extra again if Extra holds it.
+//
+// Both are filled in, and written out, whenever a whole message is
+// unmarshalled or marshalled, such as a Commodity or Journal.  A method of
+// an embedded type sees only that type, and not the struct around it, so
+// the message types themselves have the MarshalJSON and UnmarshalJSON
+// methods, which hand the message to decodeExtras and encodeExtras to deal
+// with everything inside it.
+type Extras struct {
+	Extra   map[string]json.RawMessage `json:"-"` // Fields not otherwise decoded, as received
+	missing uint64                     // Bit i is set if field i was absent when decoded
+}
+
+// structFields describes the JSON fields of a struct type embedding Extras.
+type structFields struct {
+	names     []string       // JSON names, in the order encoding/json writes them
+	keys      [][]byte       // Each name quoted, followed by a colon
+	index     []int          // Index of the struct field for each name
+	omitEmpty []bool         // Whether each field is tagged omitempty
+	nested    []bool         // Whether each field holds Extras of its own
+	lenient   []bool         // Whether each field is of a lenient type
+	byName    map[string]int // Position of each JSON name
+	byFold    map[string]int // Position of each lower cased JSON name
+	extras    int            // Index of the embedded Extras, or -1
+}
+
+// lenient is implemented by field types, such as Timestamp, that unmarshal
+// anything they can't make sense of as their zero value rather than failing
+// the whole message.
+type lenient interface {
+	// decodeError returns the error decoding data, if any.
+	decodeError(data []byte) error
+}
+
+var (
+	extrasType    = reflect.TypeOf(Extras{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	lenientType   = reflect.TypeOf((*lenient)(nil)).Elem()
+)
+
+// knownFields caches the structFields of each struct type, and
+// holdsExtrasCache what holdsExtras reports for each type.
+var knownFields, holdsExtrasCache sync.Map
+
+// jsonFields returns the structFields of t, a struct type.  Only the first
+// 64 fields can be noted as missing, which is more than any message has.
+func jsonFields(t reflect.Type) *structFields {
+	if fields, ok := knownFields.Load(t); ok {
+		return fields.(*structFields)
+	}
+
+	fields := &structFields{
+		byName: make(map[string]int),
+		byFold: make(map[string]int),
+		extras: -1,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type == extrasType {
+			fields.extras = i
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		key, _ := json.Marshal(name)
+		omitEmpty := false
+
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+
+		fields.byName[name] = len(fields.names)
+		fields.byFold[strings.ToLower(name)] = len(fields.names)
+		fields.names = append(fields.names, name)
+		fields.keys = append(fields.keys, append(key, ':'))
+		fields.index = append(fields.index, i)
+		fields.omitEmpty = append(fields.omitEmpty, omitEmpty)
+		fields.nested = append(fields.nested, holdsExtras(field.Type))
+		fields.lenient = append(fields.lenient, field.Type.Implements(lenientType))
+	}
+
+	knownFields.Store(t, fields)
+
+	return fields
+}
+
+// holdsExtras reports whether values of t, or any of its elements, are
+// structs embedding Extras that decodeExtras and encodeExtras need to visit.
+// Types marshalling themselves are left to do so.
+func holdsExtras(t reflect.Type) bool {
+	if holds, ok := holdsExtrasCache.Load(t); ok {
+		return holds.(bool)
+	}
+
+	var holds bool
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		holds = holdsExtras(t.Elem())
+
+	case reflect.Struct:
+		if !t.Implements(marshalerType) {
+			field, ok := t.FieldByName("Extras")
+			holds = ok && field.Anonymous && field.Type == extrasType
+		}
+	}
+
+	holdsExtrasCache.Store(t, holds)
+
+	return holds
+}
+
+// lookup returns the position of the field named key, a JSON string
+// without its quotes, or -1 if there is none.  Names are matched without
+// regard to case, as encoding/json does.
+func (fields *structFields) lookup(key []byte) int {
+	if bytes.IndexByte(key, '\\') < 0 {
+		if n, ok := fields.byName[string(key)]; ok {
+			return n
+		}
+	}
+
+	if n, ok := fields.byFold[strings.ToLower(unquoteKey(key))]; ok {
+		return n
+	}
+
+	return -1
+}
+
+// unquoteKey returns the JSON string key, without its quotes, as a string.
+func unquoteKey(key []byte) string {
+	if bytes.IndexByte(key, '\\') < 0 {
+		return string(key)
+	}
+
+	var name string
+
+	quoted := make([]byte, 0, len(key)+2)
+	quoted = append(append(append(quoted, '"'), key...), '"')
+	json.Unmarshal(quoted, &name)
+
+	return name
+}
+
+// decodeExtras unmarshals the JSON object data into v, a pointer to a
+// struct, filling in the Extras of v and of everything within it.  The
+// fields are decoded once by encoding/json, with data then scanned once for
+// the fields nothing was decoded into.  If some fields could not be decoded
+// v is filled in all the same, and a *FieldError returned.
+func decodeExtras(data []byte, v interface{}) (err error) {
+	if err = json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	_, failed := collectExtras(data, skipJSONSpace(data, 0),
+		reflect.ValueOf(v).Elem(), nil)
+
+	if failed != nil {
+		return &FieldError{failed}
+	}
+
+	return nil
+}
+
+// decodeFailed reports whether err, from decodeExtras, means the message
+// couldn't be decoded at all, rather than that only some fields couldn't.
+func decodeFailed(err error) bool {
+	var fieldErr *FieldError
+
+	return err != nil && !errors.As(err, &fieldErr)
+}
+
+// collectExtras fills in the Extras within value, from the JSON value in
+// data starting at i, which has already been decoded into it.  It returns
+// the index just past the JSON value, and failed with the fields that could
+// not be decoded appended.
+func collectExtras(data []byte, i int, value reflect.Value,
+	failed []string) (end int, _ []string) {
+
+	if !holdsExtras(value.Type()) {
+		return skipJSONValue(data, i), failed
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return skipJSONValue(data, i), failed
+		}
+
+		return collectExtras(data, i, value.Elem(), failed)
+
+	case reflect.Slice, reflect.Array:
+		if data[i] != '[' {
+			return skipJSONValue(data, i), failed
+		}
+
+		for n, i := 0, skipJSONSpace(data, i+1); ; n++ {
+			if data[i] == ']' {
+				return i + 1, failed
+			}
+
+			if n < value.Len() {
+				i, failed = collectExtras(data, i, value.Index(n), failed)
+			} else {
+				i = skipJSONValue(data, i)
+			}
+
+			if i = skipJSONSpace(data, i); data[i] == ',' {
+				i = skipJSONSpace(data, i+1)
+			}
+		}
+	}
+
+	if data[i] != '{' {
+		return skipJSONValue(data, i), failed
+	}
+
+	fields := jsonFields(value.Type())
+	extras := value.Field(fields.extras).Addr().Interface().(*Extras)
+	extras.Extra = nil
+
+	var seen uint64
+
+	for i = skipJSONSpace(data, i+1); data[i] != '}'; {
+		keyEnd := skipJSONValue(data, i)
+		key := data[i+1 : keyEnd-1]
+		i = skipJSONSpace(data, skipJSONSpace(data, keyEnd)+1)
+
+		n := fields.lookup(key)
+		keep := n < 0
+
+		if n >= 0 {
+			seen |= 1 << uint(n)
+			field := value.Field(fields.index[n])
+
+			if fields.nested[n] {
+				end, failed = collectExtras(data, i, field, failed)
+			} else {
+				end = skipJSONValue(data, i)
+			}
+
+			if fields.lenient[n] && field.IsZero() {
+				if err := field.Addr().Interface().(lenient).decodeError(data[i:end]); err != nil {
+					failed = append(failed, unquoteKey(key)+": "+err.Error())
+					keep = true
+				}
+			}
+		} else {
+			end = skipJSONValue(data, i)
+		}
+
+		if keep {
+			if extras.Extra == nil {
+				extras.Extra = make(map[string]json.RawMessage)
+			}
+
+			extras.Extra[unquoteKey(key)] = append(json.RawMessage(nil), data[i:end]...)
+		}
+
+		if i = skipJSONSpace(data, end); data[i] == ',' {
+			i = skipJSONSpace(data, i+1)
+		}
+	}
+
+	extras.missing = 0
+
+	for n := range fields.names {
+		if n < 64 && seen&(1<<uint(n)) == 0 {
+			extras.missing |= 1 << uint(n)
+		}
+	}
+
+	return i + 1, failed
+}
+
+// skipJSONSpace returns the index of the first byte at or after i in data that
+// isn't JSON whitespace.
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' ||
+		data[i] == '\r' || data[i] == '\n') {
+		i++
+	}
+
+	return i
+}
+
+// skipJSONValue returns the index just past the JSON value starting at i in
+// data, which must be valid JSON.
+func skipJSONValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		for i++; data[i] != '"'; i++ {
+			if data[i] == '\\' {
+				i++
+			}
+		}
+
+		return i + 1
+
+	case '{', '[':
+		for depth := 0; ; i++ {
+			switch data[i] {
+			case '"':
+				i = skipJSONValue(data, i) - 1
+
+			case '{', '[':
+				depth++
+
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+
+	for i < len(data) && data[i] != ',' && data[i] != '}' && data[i] != ']' &&
+		data[i] != ' ' && data[i] != '\t' && data[i] != '\r' && data[i] != '\n' {
+		i++
+	}
+
+	return i
+}
+
+// encodeExtras marshals v, writing out the Extras of v and of everything
+// within it.  Fields of Extra that their struct has a field for are only
+// written in place of that field while it is zero.
+func encodeExtras(v interface{}) (data []byte, err error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+
+	if err = encodeValue(&buf, encoder, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeValue writes value to buf, leaving anything not holding Extras to
+// encoder.
+func encodeValue(buf *bytes.Buffer, encoder *json.Encoder, value reflect.Value) error {
+	if value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		if value.Kind() == reflect.Interface {
+			return encodeValue(buf, encoder, value.Elem())
+		}
+	}
+
+	if !holdsExtras(value.Type()) {
+		if err := encoder.Encode(value.Interface()); err != nil {
+			return err
+		}
+
+		// Encode ends every value with a newline.
+		buf.Truncate(buf.Len() - 1)
+
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		return encodeValue(buf, encoder, value.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('[')
+
+		for n := 0; n < value.Len(); n++ {
+			if n > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeValue(buf, encoder, value.Index(n)); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+
+		return nil
+	}
+
+	fields := jsonFields(value.Type())
+	extras := value.Field(fields.extras).Interface().(Extras)
+	start := buf.Len()
+
+	buf.WriteByte('{')
+
+	for n, name := range fields.names {
+		field := value.Field(fields.index[n])
+		missing := n < 64 && extras.missing&(1<<uint(n)) != 0
+		raw, kept := extras.Extra[name]
+
+		if (kept || missing) && !field.IsZero() {
+			kept, missing = false, false
+		}
+
+		if !kept && (missing || fields.omitEmpty[n] && isEmptyValue(field)) {
+			continue
+		}
+
+		if buf.Len() > start+1 {
+			buf.WriteByte(',')
+		}
+
+		buf.Write(fields.keys[n])
+
+		if kept {
+			buf.Write(raw)
+		} else if err := encodeValue(buf, encoder, field); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(extras.Extra))
+
+	for name := range extras.Extra {
+		if _, ok := fields.byFold[strings.ToLower(name)]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if buf.Len() > start+1 {
+			buf.WriteByte(',')
+		}
+
+		if err := encoder.Encode(name); err != nil {
+			return err
+		}
+
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		buf.Write(extras.Extra[name])
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+// isEmptyValue reports whether value is empty in the sense of omitempty.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+
+	case reflect.Bool:
+		return !value.Bool()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return value.Uint() == 0
+
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+
+	case reflect.Interface, reflect.Ptr:
+		return value.IsNil()
+	}
+
+	return false
+}
+
+// UnmarshalJSON decodes data, keeping any fields the message lacks in its
+// Extras.
+func (msg *Blackmarket) UnmarshalJSON(data []byte) error {
+	type plain Blackmarket
+	return decodeExtras(data, (*plain)(msg))
+}
+
+// MarshalJSON encodes msg along with its Extras.
+func (msg Blackmarket) MarshalJSON() ([]byte, error) {
+	type plain Blackmarket
+	return encodeExtras(plain(msg))
+}
+
+// UnmarshalJSON decodes data, keeping any fields the message lacks in its
+// Extras.
+func (msg *Commodity) UnmarshalJSON(data []byte) error {
+	type plain Commodity
+	return decodeExtras(data, (*plain)(msg))
+}
+
+// MarshalJSON encodes msg along with its Extras.
+func (msg Commodity) MarshalJSON() ([]byte, error) {
+	type plain Commodity
+	return encodeExtras(plain(msg))
+}
+
+// MarshalJSON encodes msg along with its Extras.  Journal messages are
+// decoded by their SchemaDefinition, which picks the type of Message.
+func (msg Journal) MarshalJSON() ([]byte, error) {
+	type plain Journal
+	return encodeExtras(plain(msg))
+}
+
+// UnmarshalJSON decodes data, keeping any fields the message lacks in its
+// Extras.
+func (msg *Outfitting) UnmarshalJSON(data []byte) error {
+	type plain Outfitting
+	return decodeExtras(data, (*plain)(msg))
+}
+
+// MarshalJSON encodes msg along with its Extras.
+func (msg Outfitting) MarshalJSON() ([]byte, error) {
+	type plain Outfitting
+	return encodeExtras(plain(msg))
+}
+
+// UnmarshalJSON decodes data, keeping any fields the message lacks in its
+// Extras.
+func (msg *Shipyard) UnmarshalJSON(data []byte) error {
+	type plain Shipyard
+	return decodeExtras(data, (*plain)(msg))
+}
+
+// MarshalJSON encodes msg along with its Extras.
+func (msg Shipyard) MarshalJSON() ([]byte, error) {
+	type plain Shipyard
+	return encodeExtras(plain(msg))
+}
@@ -0,0 +1,279 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// sameJSON reports whether a and b hold the same JSON value.
+func sameJSON(t *testing.T, a []byte, b []byte) bool {
+	var va, vb interface{}
+
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatal(err)
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
+
+// withoutMissing returns a copy of v with every note of the fields missing
+// when it was decoded cleared, for comparison with values built by hand.
+func withoutMissing(v interface{}) interface{} {
+	value := reflect.New(reflect.TypeOf(v)).Elem()
+	value.Set(reflect.ValueOf(v))
+	clearMissing(value)
+
+	return value.Interface()
+}
+
+// clearMissing clears the missing fields within the addressable value.
+func clearMissing(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Field(i)
+
+			if value.Type().Field(i).Name != "missing" {
+				clearMissing(field)
+				continue
+			}
+
+			// The field is unexported, so can only be set through its address.
+			field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+			field.Set(reflect.Zero(field.Type()))
+		}
+
+	case reflect.Slice:
+		if value.IsNil() {
+			return
+		}
+
+		// The elements are copied, leaving the original slice alone.
+		elements := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		reflect.Copy(elements, value)
+		value.Set(elements)
+
+		for i := 0; i < value.Len(); i++ {
+			clearMissing(value.Index(i))
+		}
+	}
+}
+
+func TestExtraFieldsRoundTrip(t *testing.T) {
+	header := `"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0",` +
+		`"gameversion":"4.0.0.1450","gamebuild":"r294054/r0 "}`
+
+	tests := []string{
+		`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` + header + `,` +
+			`"message":{"event":"Docked","timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+			`"StarPos":[0,0,0],"StationName":"Abraham Lincoln","StationType":"Orbis",` +
+			`"StationFaction":"Mother Gaia","StationGovernment":"$government_Democracy;",` +
+			`"StationAllegiance":"Federation","StationEconomy":"$economy_Service;",` +
+			`"DistFromStarLS":505.2,"FactionState":"Boom","MarketID":128016640,` +
+			`"StationServices":["dock","autodock","commodities"],"Security":"$GAlAXY_MAP_INFO_state_high;"},` +
+			`"relayed":true}`,
+		`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` + header + `,` +
+			`"message":{"event":"Location","timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+			`"SystemAddress":10477373803,"StarPos":[0,0,0],"Body":"Earth","BodyID":3,` +
+			`"BodyType":"Planet","Docked":false,"Population":22780919531,` +
+			`"SystemAllegiance":"Federation","SystemEconomy":"$economy_Refinery;",` +
+			`"SystemSecondEconomy":"$economy_Service;","SystemGovernment":"$government_Democracy;",` +
+			`"SystemSecurity":"$SYSTEM_SECURITY_high;","PowerplayState":"Controlled",` +
+			`"Factions":[{"Name":"Mother Gaia","FactionState":"Boom","Government":"Democracy",` +
+			`"Influence":0.1,"Allegiance":"Federation","Happiness":"$Faction_HappinessBand2;",` +
+			`"ActiveStates":[{"State":"Boom"}]}]}}`,
+		`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",` + header + `,` +
+			`"message":{"systemName":"Sol","stationName":"Abraham Lincoln","marketId":128016640,` +
+			`"timestamp":"2020-01-01T00:00:00Z","horizons":true,"commodities":[{"name":"gold",` +
+			`"meanPrice":47609,"buyPrice":0,"stock":0,"stockBracket":0,"sellPrice":48000,` +
+			`"demand":12,"demandBracket":1,"statusFlags":["rare"]}]}}`,
+	}
+
+	for _, data := range tests {
+		msg, err := ParseMessage([]byte(data))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := json.Marshal(msg)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !sameJSON(t, []byte(data), out) {
+			t.Errorf("re-marshalled message differs:\n got %s\nwant %s", out, data)
+		}
+	}
+}
+
+func TestExtraFieldsDecoded(t *testing.T) {
+	var msg Commodity
+
+	err := json.Unmarshal([]byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",`+
+		`"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0"},`+
+		`"message":{"systemName":"Sol","SYSTEMNAME":"Sol","marketId":1},"relayed":true}`), &msg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]json.RawMessage{"marketId": json.RawMessage(`1`)}
+
+	if !reflect.DeepEqual(msg.Message.Extra, want) {
+		t.Errorf("got message Extra %s, want %s", msg.Message.Extra, want)
+	}
+
+	// Unknown fields beside the header and $schemaRef are kept too.
+	if string(msg.Extra["relayed"]) != `true` || len(msg.Extra) != 1 {
+		t.Errorf("got Extra %s", msg.Extra)
+	}
+
+	// Fields with a field of their own are never duplicated from Extra.
+	msg.Message.Extra["systemName"] = json.RawMessage(`"Achenar"`)
+
+	out, err := json.Marshal(msg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameJSON(t, out, []byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",`+
+		`"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0"},`+
+		`"message":{"systemName":"Sol","marketId":1},"relayed":true}`)) {
+		t.Errorf("got %s", out)
+	}
+}
+
+func TestExtraFieldsSparseRoundTrip(t *testing.T) {
+	data := []byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0"},` +
+		`"message":{"event":"Location","StarSystem":"Sol","SystemAddress":10477373803,` +
+		`"Factions":[{"Name":"Mother Gaia","Influence":0}],"Docked":false}}`)
+
+	msg, err := ParseMessage(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := json.Marshal(msg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the missing timestamp, StarPos, or SystemSecurity appear, while
+	// the zero Influence and Docked that were sent do.
+	if !sameJSON(t, data, out) {
+		t.Errorf("re-marshalled message differs:\n got %s\nwant %s", out, data)
+	}
+
+	// Missing fields set since decoding are marshalled all the same.
+	journal := msg.(Journal)
+	location := journal.Message.(JournalLocation)
+	location.SystemSecurity = "$SYSTEM_SECURITY_high;"
+	journal.Message = location
+
+	if out, err = json.Marshal(journal); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Message map[string]interface{} `json:"message"`
+	}
+
+	if err = json.Unmarshal(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Message["SystemSecurity"] != "$SYSTEM_SECURITY_high;" ||
+		decoded.Message["timestamp"] != nil {
+		t.Errorf("got %s after setting SystemSecurity", out)
+	}
+}
+
+func TestExtraFieldsUpgraded(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/2",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},` +
+		`"message":{"systemName":"Eranin","stationName":"Azeban City","marketId":1,` +
+		`"timestamp":"2015-01-01T00:00:00Z","commodities":[{"name":"gold","buyPrice":0,` +
+		`"supply":0,"sellPrice":9000,"demand":12,"demandLevel":"Low","rare":true}]}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commodity := msg.(Commodity)
+
+	if string(commodity.Message.Extra["marketId"]) != `1` ||
+		string(commodity.Message.Commodities[0].Extra["rare"]) != `true` {
+		t.Errorf("upgraded message has Extra %s, commodity Extra %s",
+			commodity.Message.Extra, commodity.Message.Commodities[0].Extra)
+	}
+}
+
+func TestExtraFieldsUndecodable(t *testing.T) {
+	header := `"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"5.0"}`
+
+	tests := []struct {
+		data   string
+		fields int
+	}{
+		{`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` + header + `,` +
+			`"message":{"event":"FSDJump","timestamp":"yesterday","StarSystem":"Sol",` +
+			`"StarPos":[0,0],"SystemAddress":10477373803}}`, 2},
+		{`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",` + header + `,` +
+			`"message":{"systemName":"Sol","stationName":"Abraham Lincoln",` +
+			`"timestamp":20200101,"commodities":[]}}`, 1},
+	}
+
+	for _, test := range tests {
+		msg, err := ParseMessage([]byte(test.data))
+
+		// The rest of the message is decoded all the same...
+		var msgErr *MessageError
+		var fieldErr *FieldError
+
+		if msg == nil || !errors.As(err, &msgErr) || msgErr.Kind != ErrorField ||
+			!errors.As(err, &fieldErr) || len(fieldErr.Errors) != test.fields {
+			t.Errorf("got %v, %v", msg, err)
+			continue
+		}
+
+		// ...with the fields left zero, and re-marshalled as received.
+		switch msg := msg.(type) {
+		case Journal:
+			jump := msg.Message.(JournalFSDJump)
+
+			if !jump.Timestamp.IsZero() || jump.StarPos != (Vec3{}) ||
+				string(jump.Extra["StarPos"]) != `[0,0]` || jump.StarSystem != "Sol" {
+				t.Errorf("got %+v", jump)
+			}
+
+		case Commodity:
+			if !msg.Message.Timestamp.IsZero() ||
+				string(msg.Message.Extra["timestamp"]) != `20200101` {
+				t.Errorf("got %+v", msg.Message)
+			}
+		}
+
+		out, err := json.Marshal(msg)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !sameJSON(t, []byte(test.data), out) {
+			t.Errorf("re-marshalled message differs:\n got %s\nwant %s", out, test.data)
+		}
+	}
+}
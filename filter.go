@@ -0,0 +1,173 @@
+package EDDNClient
+
+import (
+	"strings"
+)
+
+// MessageInfo is the summary of a message that Filters are evaluated
+// against.  It is read from the message before the message is decoded, so
+// filtering out unwanted messages is cheap.
+type MessageInfo struct {
+	SchemaRef       string // The full $schemaRef
+	Family          string // Schema family, such as "journal" or "commodity"
+	Version         string // Schema version, such as "1"
+	Test            bool   // Whether the message uses a /test schema
+	Event           string // The journal event, if a journal message
+	SoftwareName    string // Header softwareName
+	SoftwareVersion string // Header softwareVersion
+	UploaderID      string // Header uploaderID
+	SystemName      string // The systemName, or journal StarSystem or System
+	StarPos         Vec3   // The journal StarPos, if HasStarPos
+	HasStarPos      bool   // Whether the message has a valid StarPos
+}
+
+// A Filter decides which messages a ChannelInterface, EventStream, or
+// Subscriber receives.  Filters are composed with All, Any, Not, and
+// Exclude; for example, FSD jumps within 100ly of Sol uploaded by
+// particular commanders:
+//
+//	All(Events("FSDJump"), Within(Vec3{0, 0, 0}, 100),
+//		Uploaders("cmdr1", "cmdr2"))
+type Filter interface {
+	Match(info *MessageInfo) bool // Whether the message is wanted
+}
+
+// FilterFunc adapts an ordinary function to the Filter interface.
+type FilterFunc func(info *MessageInfo) bool
+
+// Match calls f(info).
+func (f FilterFunc) Match(info *MessageInfo) bool {
+	return f(info)
+}
+
+// All returns a Filter matching messages matched by every one of filters.
+// Nil filters are ignored.
+func All(filters ...Filter) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		for _, filter := range filters {
+			if filter != nil && !filter.Match(info) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// Any returns a Filter matching messages matched by at least one of
+// filters.
+func Any(filters ...Filter) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		for _, filter := range filters {
+			if filter != nil && filter.Match(info) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Not returns a Filter matching the messages filter doesn't.
+func Not(filter Filter) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		return !filter.Match(info)
+	})
+}
+
+// Exclude returns a Filter matching messages matched by none of filters.
+func Exclude(filters ...Filter) Filter {
+	return Not(Any(filters...))
+}
+
+// Schemas returns a Filter matching messages of the given schema families.
+// A family may be given with a version, as in "commodity/3", to match only
+// that version.
+func Schemas(families ...string) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		for _, family := range families {
+			if family == info.Family || family == info.Family+"/"+info.Version {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Events returns a Filter matching journal messages with any of the given
+// events, such as "FSDJump" or "Scan".
+func Events(events ...string) Filter {
+	return matchAny(events, func(info *MessageInfo) string {
+		return info.Event
+	})
+}
+
+// Software returns a Filter matching messages uploaded by any of the named
+// software.
+func Software(names ...string) Filter {
+	return matchAny(names, func(info *MessageInfo) string {
+		return info.SoftwareName
+	})
+}
+
+// Uploaders returns a Filter matching messages from any of the given
+// uploader IDs.
+func Uploaders(ids ...string) Filter {
+	return matchAny(ids, func(info *MessageInfo) string {
+		return info.UploaderID
+	})
+}
+
+// Systems returns a Filter matching messages about any of the named star
+// systems.  System names are compared without regard to case.
+func Systems(names ...string) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		for _, name := range names {
+			if strings.EqualFold(name, info.SystemName) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Within returns a Filter matching messages with a StarPos no further than
+// radius light years from center.  Messages without a StarPos never match.
+func Within(center Vec3, radius float64) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		return info.HasStarPos && info.StarPos.Within(center, radius)
+	})
+}
+
+// MaskFilter returns a Filter equivalent to the Filter* bitmask filter
+// accepted by NewChannelInterface, which excludes the schema families whose
+// bits are set.
+func MaskFilter(mask int) Filter {
+	masks := map[string]int{
+		"journal":     FilterJournal,
+		"shipyard":    FilterShipyard,
+		"commodity":   FilterCommodity,
+		"blackmarket": FilterBlackmarket,
+		"outfitting":  FilterOutfitting,
+	}
+
+	return FilterFunc(func(info *MessageInfo) bool {
+		return mask&masks[info.Family] == 0
+	})
+}
+
+// matchAny returns a Filter matching messages for which field returns any
+// of values.
+func matchAny(values []string, field func(info *MessageInfo) string) Filter {
+	return FilterFunc(func(info *MessageInfo) bool {
+		for _, value := range values {
+			if value == field(info) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
@@ -0,0 +1,66 @@
+package EDDNClient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	fsdJump := `{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1",` +
+		`"header":{"uploaderID":"cmdr1","softwareName":"EDDiscovery","softwareVersion":"1"},` +
+		`"message":{"event":"FSDJump","StarSystem":"Eravate","StarPos":[-42.438,-3.156,59.656],"timestamp":"2017-02-20T18:01:00Z"}}`
+	commodity := `{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",` +
+		`"header":{"uploaderID":"cmdr2","softwareName":"EDMC","softwareVersion":"1"},` +
+		`"message":{"systemName":"Sol","stationName":"Abraham Lincoln","commodities":[]}}`
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		jump, com bool
+	}{
+		{"schema", Schemas("journal"), true, false},
+		{"schema version", Schemas("commodity/3"), false, true},
+		{"wrong version", Schemas("commodity/2"), false, false},
+		{"event", Events("FSDJump"), true, false},
+		{"software", Software("EDMC"), false, true},
+		{"uploader", Uploaders("cmdr1"), true, false},
+		{"system", Systems("sol"), false, true},
+		{"within", Within(Vec3{-40, -3, 60}, 5), true, false},
+		{"outside", Within(Vec3{0, 0, 0}, 5), false, false},
+		{"exclude", Exclude(Schemas("journal")), false, true},
+		{"all", All(Events("FSDJump"), Uploaders("cmdr2")), false, false},
+		{"any", Any(Events("FSDJump"), Uploaders("cmdr2")), true, true},
+		{"mask", MaskFilter(FilterJournal), false, true},
+	}
+
+	jumpInfo, err := peekMessage(strings.NewReader(fsdJump))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comInfo, err := peekMessage(strings.NewReader(commodity))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Match(jumpInfo); got != test.jump {
+			t.Errorf("%s: FSDJump matched %v, want %v", test.name, got, test.jump)
+		}
+
+		if got := test.filter.Match(comInfo); got != test.com {
+			t.Errorf("%s: commodity matched %v, want %v", test.name, got, test.com)
+		}
+	}
+
+	// A StarPos that isn't three numbers is near nothing, and doesn't fail
+	// the message before it is decoded.
+	short := strings.Replace(fsdJump, "[-42.438,-3.156,59.656]", "[0,0]", 1)
+	shortInfo, err := peekMessage(strings.NewReader(short))
+
+	if err != nil || shortInfo.HasStarPos || Within(Vec3{0, 0, 0}, 5).Match(shortInfo) {
+		t.Errorf("got %+v, %v for a short StarPos", shortInfo, err)
+	}
+}
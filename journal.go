@@ -1,123 +1,135 @@
 package EDDNClient
 
+import (
+	"encoding/json"
+)
+
 // Ring describes planetary rings of a body that may or may not be included
 // in a journal message.
 type Ring struct {
-	InnerRad  float64 `mapstructure:"InnerRad" json:"InnerRad"`
-	MassMT    float64 `mapstructure:"MassMT" json:"MassMT"`
-	Name      string  `mapstructure:"Name" json:"Name"`
-	OuterRad  float64 `mapstructure:"OuterRad" json:"OuterRad"`
-	RingClass string  `mapstructure:"RingClass" json:"RingClass"`
+	InnerRad  float64 `json:"InnerRad"`
+	MassMT    float64 `json:"MassMT"`
+	Name      string  `json:"Name"`
+	OuterRad  float64 `json:"OuterRad"`
+	RingClass string  `json:"RingClass"`
+	Extras            // Fields not otherwise decoded, see Extras
 }
 
 // Composition describes atmospheric composition that may or may not be
 // included in a journal Message.
 type Composition struct {
-	Name    string  `mapstructure:"Name" json:"Name"`
-	Percent float64 `mapstructure:"Percent" json:"Percent"`
+	Name    string  `json:"Name"`
+	Percent float64 `json:"Percent"`
+	Extras          // Fields not otherwise decoded, see Extras
 }
 
 // Material describes the name, and percentage contained on a planet, or moon.
 type Material struct {
-	Name    string  `mapstructure:"Name" json:"Name"`
-	Percent float64 `mapstructure:"Percent" json:"Percent"`
+	Name    string  `json:"Name"`
+	Percent float64 `json:"Percent"`
+	Extras          // Fields not otherwise decoded, see Extras
 }
 
 // Faction describes an individual faction that may or may not be included
 // in the journal Message.
 type Faction struct {
-	Allegiance   string  `mapstructure:"Allegiance" json:"Allegiance"`
-	FactionState string  `mapstructure:"FactionState" json:"FactionState"`
-	Government   string  `mapstructure:"Government" json:"Government"`
-	Influence    float32 `mapstructure:"Influence" json:"Influence"`
-	Name         string  `mapstructure:"Name" json:"Name"`
+	Allegiance   string  `json:"Allegiance"`
+	FactionState string  `json:"FactionState"`
+	Government   string  `json:"Government"`
+	Influence    float64 `json:"Influence"`
+	Name         string  `json:"Name"`
+	Extras               // Fields not otherwise decoded, see Extras
 }
 
-// JournalDocked contains information pertaining to a 'docked' event.  This
-// is missing the 'Security' field, but it seems to mostly go unused with this
-// event so it's omitted for now.
+// JournalDocked contains information pertaining to a 'docked' event.  It has
+// no field for 'Security', which seems to mostly go unused with this event,
+// so that is kept in Extra along with anything else.
 type JournalDocked struct {
-	StarSystem        string    `mapstructure:"StarSystem" json:"StarSystem"`
-	StationFaction    string    `mapstructure:"StationFaction" json:"StationFaction"`
-	StationGovernment string    `mapstructure:"StationGovernment" json:"StationGovernment"`
-	Timestamp         string    `mapstructure:"timestamp" json:"timestamp"`
-	StationAllegiance string    `mapstructure:"StationAllegiance" json:"StationAllegiance"`
-	StationEconomy    string    `mapstructure:"StationEconomy" json:"StationEconomy"`
-	StarPos           []float64 `mapstructure:"StarPos" json:"StarPos"`
-	StationName       string    `mapstructure:"StationName" json:"StationName"`
-	StationType       string    `mapstructure:"StationType" json:"StationType"`
-	DistFromStarLS    float64   `mapstructure:"DistFromStarLS" json:"DistFromStarLS"`
-	FactionState      string    `mapstructure:"FactionState" json:"FactionState"`
-	Event             string    `mapstructure:"event" json:"event"`
+	StarSystem        string    `json:"StarSystem"`
+	StationFaction    string    `json:"StationFaction"`
+	StationGovernment string    `json:"StationGovernment"`
+	Timestamp         Timestamp `json:"timestamp"`
+	StationAllegiance string    `json:"StationAllegiance"`
+	StationEconomy    string    `json:"StationEconomy"`
+	StarPos           Vec3      `json:"StarPos"`
+	StationName       string    `json:"StationName"`
+	StationType       string    `json:"StationType"`
+	DistFromStarLS    float64   `json:"DistFromStarLS"`
+	FactionState      string    `json:"FactionState"`
+	Event             string    `json:"event"`
+	Extras                      // Fields not otherwise decoded, see Extras
 }
 
 // JournalScanStar contains information about a scanned star.  This is used
 // when a journal entry has a StarType field.  Barring that a JournalScanPlanet
 // type will be used.
 type JournalScanStar struct {
-	StellarMass           float64   `mapstructure:"StellarMass" json:"StellarMass"`
-	BodyName              string    `mapstructure:"BodyName" json:"BodyName"`
-	StarSystem            string    `mapstructure:"StarSystem" json:"StarSystem"`
-	Timestamp             string    `mapstructure:"timestamp" json:"timestamp"`
-	RotationPeriod        float64   `mapstructure:"RotationPeriod" json:"RotationPeriod"`
-	Rings                 []Ring    `mapstructure:"Rings" json:"Rings"`
-	StarType              string    `mapstructure:"StarType" json:"StarType"`
-	Radius                float64   `mapstructure:"Radius" json:"Radius"`
-	AbsoluteMagnitude     float64   `mapstructure:"AbsoluteMagnitude" json:"AbsoluteMagnitude"`
-	StarPos               []float64 `mapstructure:"StarPos" json:"StarPos"`
-	AgeMy                 int       `mapstructure:"Age_MY" json:"Age_MY"`
-	Event                 string    `mapstructure:"event" json:"event"`
-	DistanceFromArrivalLS float64   `mapstructure:"DistanceFromArrivalLS" json:"DistanceFromArrivalLS"`
-	SurfaceTemperature    float64   `mapstructure:"SurfaceTemperature" json:"SurfaceTemperature"`
-	Eccentricity          float64   `mapstructure:"Eccentricity" json:"Eccentricity"`
-	OrbitalInclination    float64   `mapstructure:"OrbitalInclination" json:"OrbitalInclination"`
-	OrbitalPeriod         float64   `mapstructure:"OrbitalPeriod" json:"OrbitalPeriod"`
-	Periapsis             float64   `mapstructure:"Periapsis" json:"Periapsis"`
-	SemiMajorAxis         float64   `mapstructure:"SemiMajorAxis" json:"SemiMajorAxis"`
+	StellarMass           float64   `json:"StellarMass"`
+	BodyName              string    `json:"BodyName"`
+	StarSystem            string    `json:"StarSystem"`
+	Timestamp             Timestamp `json:"timestamp"`
+	RotationPeriod        float64   `json:"RotationPeriod"`
+	Rings                 []Ring    `json:"Rings"`
+	StarType              string    `json:"StarType"`
+	Radius                float64   `json:"Radius"`
+	AbsoluteMagnitude     float64   `json:"AbsoluteMagnitude"`
+	StarPos               Vec3      `json:"StarPos"`
+	AgeMy                 int       `json:"Age_MY"`
+	Event                 string    `json:"event"`
+	DistanceFromArrivalLS float64   `json:"DistanceFromArrivalLS"`
+	SurfaceTemperature    float64   `json:"SurfaceTemperature"`
+	Eccentricity          float64   `json:"Eccentricity"`
+	OrbitalInclination    float64   `json:"OrbitalInclination"`
+	OrbitalPeriod         float64   `json:"OrbitalPeriod"`
+	Periapsis             float64   `json:"Periapsis"`
+	SemiMajorAxis         float64   `json:"SemiMajorAxis"`
+	Extras                          // Fields not otherwise decoded, see Extras
 }
 
 // JournalScanPlanet contains information about a scanned moon, or planet.
 // This is used when a journal entry does NOT have a StarType field.  If it
 // does then a JournalScanStar type will be used.
 type JournalScanPlanet struct {
-	Eccentricity          float64    `mapstructure:"Eccentricity" json:"Eccentricity"`
-	OrbitalInclination    float64    `mapstructure:"OrbitalInclination" json:"OrbitalInclination"`
-	OrbitalPeriod         float64    `mapstructure:"OrbitalPeriod" json:"OrbitalPeriod"`
-	Periapsis             float64    `mapstructure:"Periapsis" json:"Periapsis"`
-	SemiMajorAxis         float64    `mapstructure:"SemiMajorAxis" json:"SemiMajorAxis"`
-	BodyName              string     `mapstructure:"BodyName" json:"BodyName"`
-	DistanceFromArrivalLS float64    `mapstructure:"DistanceFromArrivalLS" json:"DistanceFromArrivalLS"`
-	TidalLock             bool       `mapstructure:"TidalLock" json:"TidalLock"`
-	TerraformState        string     `mapstructure:"TerraformState" json:"TerraformState"`
-	PlanetClass           string     `mapstructure:"PlanetClass" json:"PlanetClass"`
-	SurfacePressure       float64    `mapstructure:"SurfacePressure" json:"SurfacePressure"`
-	MassEM                float64    `mapstructure:"MassEM" json:"MassEM"`
-	RotationPeriod        float64    `mapstructure:"RotationPeriod" json:"RotationPeriod"`
-	Event                 string     `mapstructure:"event" json:"event"`
-	StarPos               []float64  `mapstructure:"StarPos" json:"StarPos"`
-	AtmosphereType        string     `mapstructure:"AtmosphereType" json:"AtmosphereType"`
-	SurfaceTemperature    float64    `mapstructure:"SurfaceTemperature" json:"SurfaceTemperature"`
-	Timestamp             string     `mapstructure:"timestamp" json:"timestamp"`
-	Materials             []Material `mapstructure:"Materials" json:"Materials"`
-	Volcanism             string     `mapstructure:"Volcanism" json:"Volcanism"`
-	StarSystem            string     `mapstructure:"StarSystem" json:"StarSystem"`
-	Atmosphere            string     `mapstructure:"Atmosphere" json:"Atmosphere"`
-	Landable              bool       `mapstructure:"Landable" json:"Landable"`
-	Radius                float64    `mapstructure:"Radius" json:"Radius"`
-	SurfaceGravity        float64    `mapstructure:"SurfaceGravity" json:"SurfaceGravity"`
+	Eccentricity          float64    `json:"Eccentricity"`
+	OrbitalInclination    float64    `json:"OrbitalInclination"`
+	OrbitalPeriod         float64    `json:"OrbitalPeriod"`
+	Periapsis             float64    `json:"Periapsis"`
+	SemiMajorAxis         float64    `json:"SemiMajorAxis"`
+	BodyName              string     `json:"BodyName"`
+	DistanceFromArrivalLS float64    `json:"DistanceFromArrivalLS"`
+	TidalLock             bool       `json:"TidalLock"`
+	TerraformState        string     `json:"TerraformState"`
+	PlanetClass           string     `json:"PlanetClass"`
+	SurfacePressure       float64    `json:"SurfacePressure"`
+	MassEM                float64    `json:"MassEM"`
+	RotationPeriod        float64    `json:"RotationPeriod"`
+	Event                 string     `json:"event"`
+	StarPos               Vec3       `json:"StarPos"`
+	AtmosphereType        string     `json:"AtmosphereType"`
+	SurfaceTemperature    float64    `json:"SurfaceTemperature"`
+	Timestamp             Timestamp  `json:"timestamp"`
+	Materials             []Material `json:"Materials"`
+	Volcanism             string     `json:"Volcanism"`
+	StarSystem            string     `json:"StarSystem"`
+	Atmosphere            string     `json:"Atmosphere"`
+	Landable              bool       `json:"Landable"`
+	Radius                float64    `json:"Radius"`
+	SurfaceGravity        float64    `json:"SurfaceGravity"`
+	Extras                           // Fields not otherwise decoded, see Extras
 }
 
 // JournalFSDJump contains information about a system after a frameshift
 // jump is performed.
 type JournalFSDJump struct {
-	StarSystem       string    `mapstructure:"StarSystem" json:"StarSystem"`
-	Timestamp        string    `mapstructure:"timestamp" json:"timestamp"`
-	Event            string    `mapstructure:"event" json:"event"`
-	SystemSecurity   string    `mapstructure:"SystemSecurity" json:"SystemSecurity"`
-	SystemAllegiance string    `mapstructure:"SystemAllegiance" json:"SystemAllegiance"`
-	SystemEconomy    string    `mapstructure:"SystemEconomy" json:"SystemEconomy"`
-	StarPos          []float64 `mapstructure:"StarPos" json:"StarPos"`
-	SystemGovernment string    `mapstructure:"SystemGovernment" json:"SystemGovernment"`
+	StarSystem       string    `json:"StarSystem"`
+	Timestamp        Timestamp `json:"timestamp"`
+	Event            string    `json:"event"`
+	SystemSecurity   string    `json:"SystemSecurity"`
+	SystemAllegiance string    `json:"SystemAllegiance"`
+	SystemEconomy    string    `json:"SystemEconomy"`
+	StarPos          Vec3      `json:"StarPos"`
+	SystemGovernment string    `json:"SystemGovernment"`
+	Extras                     // Fields not otherwise decoded, see Extras
 }
 
 // Journal is the high level type that contains the entire JSON message.
@@ -125,4 +137,124 @@ type Journal struct {
 	SchemaRef string      `json:"$schemaRef"`
 	Header    Header      `json:"header"`
 	Message   interface{} `json:"message"`
+	Extras                // Fields not otherwise decoded, see Extras
+}
+
+// Signal describes a single kind of signal found on a body by a surface
+// scan, such as "$SAA_SignalType_Geological;".
+type Signal struct {
+	Type          string `json:"Type"`
+	TypeLocalised string `json:"Type_Localised,omitempty"`
+	Count         int    `json:"Count"`
+	Extras               // Fields not otherwise decoded, see Extras
+}
+
+// Genus describes a single genus of life found on a body by a surface scan.
+type Genus struct {
+	Genus          string `json:"Genus"`
+	GenusLocalised string `json:"Genus_Localised,omitempty"`
+	Extras                // Fields not otherwise decoded, see Extras
+}
+
+// JournalLocation contains information about the system, and station if
+// docked, a commander is in when they log in or are resurrected.
+type JournalLocation struct {
+	StarSystem          string    `json:"StarSystem"`
+	SystemAddress       int64     `json:"SystemAddress"`
+	Timestamp           Timestamp `json:"timestamp"`
+	Event               string    `json:"event"`
+	StarPos             Vec3      `json:"StarPos"`
+	Body                string    `json:"Body"`
+	BodyID              int       `json:"BodyID"`
+	BodyType            string    `json:"BodyType"`
+	Docked              bool      `json:"Docked"`
+	StationName         string    `json:"StationName,omitempty"`
+	StationType         string    `json:"StationType,omitempty"`
+	MarketID            int64     `json:"MarketID,omitempty"`
+	Population          int64     `json:"Population"`
+	SystemAllegiance    string    `json:"SystemAllegiance"`
+	SystemEconomy       string    `json:"SystemEconomy"`
+	SystemSecondEconomy string    `json:"SystemSecondEconomy"`
+	SystemGovernment    string    `json:"SystemGovernment"`
+	SystemSecurity      string    `json:"SystemSecurity"`
+	Factions            []Faction `json:"Factions,omitempty"`
+	Extras                        // Fields not otherwise decoded, see Extras
+}
+
+// JournalCarrierJump contains information about the system a fleet carrier
+// has jumped to, sent by commanders docked on it at the time.
+type JournalCarrierJump struct {
+	StarSystem          string    `json:"StarSystem"`
+	SystemAddress       int64     `json:"SystemAddress"`
+	Timestamp           Timestamp `json:"timestamp"`
+	Event               string    `json:"event"`
+	StarPos             Vec3      `json:"StarPos"`
+	Body                string    `json:"Body"`
+	BodyID              int       `json:"BodyID"`
+	BodyType            string    `json:"BodyType"`
+	Docked              bool      `json:"Docked"`
+	StationName         string    `json:"StationName"`
+	StationType         string    `json:"StationType"`
+	MarketID            int64     `json:"MarketID"`
+	Population          int64     `json:"Population"`
+	SystemAllegiance    string    `json:"SystemAllegiance"`
+	SystemEconomy       string    `json:"SystemEconomy"`
+	SystemSecondEconomy string    `json:"SystemSecondEconomy"`
+	SystemGovernment    string    `json:"SystemGovernment"`
+	SystemSecurity      string    `json:"SystemSecurity"`
+	Factions            []Faction `json:"Factions,omitempty"`
+	Extras                        // Fields not otherwise decoded, see Extras
+}
+
+// JournalSAASignalsFound contains the signals found on a body mapped with
+// the detailed surface scanner.
+type JournalSAASignalsFound struct {
+	StarSystem    string    `json:"StarSystem"`
+	SystemAddress int64     `json:"SystemAddress"`
+	Timestamp     Timestamp `json:"timestamp"`
+	Event         string    `json:"event"`
+	StarPos       Vec3      `json:"StarPos"`
+	BodyName      string    `json:"BodyName"`
+	BodyID        int       `json:"BodyID"`
+	Signals       []Signal  `json:"Signals"`
+	Genuses       []Genus   `json:"Genuses,omitempty"`
+	Extras                  // Fields not otherwise decoded, see Extras
+}
+
+// JournalCodexEntry contains a discovery logged in the codex.  Unlike the
+// other journal events the game names the system by System; StarSystem,
+// which the gateway requires, is added by the sender.
+type JournalCodexEntry struct {
+	System             string    `json:"System"`
+	StarSystem         string    `json:"StarSystem,omitempty"`
+	SystemAddress      int64     `json:"SystemAddress"`
+	Timestamp          Timestamp `json:"timestamp"`
+	Event              string    `json:"event"`
+	StarPos            Vec3      `json:"StarPos"`
+	EntryID            int64     `json:"EntryID"`
+	Name               string    `json:"Name"`
+	Region             string    `json:"Region"`
+	Category           string    `json:"Category"`
+	SubCategory        string    `json:"SubCategory"`
+	BodyID             int       `json:"BodyID,omitempty"`
+	BodyName           string    `json:"BodyName,omitempty"`
+	Latitude           float64   `json:"Latitude,omitempty"`
+	Longitude          float64   `json:"Longitude,omitempty"`
+	NearestDestination string    `json:"NearestDestination,omitempty"`
+	Traits             []string  `json:"Traits,omitempty"`
+	Extras                       // Fields not otherwise decoded, see Extras
+}
+
+// JournalUnknown holds a journal event this package has no type for, so
+// that it is not lost.  Fields holds the whole event as decoded from JSON,
+// with numbers as json.Number so that large IDs are exact, and is what the
+// event is marshalled as.
+type JournalUnknown struct {
+	Event  string                 // The event, as in Fields["event"]
+	Fields map[string]interface{} // Every field of the event
+}
+
+// MarshalJSON marshals the event as Fields.
+func (msg JournalUnknown) MarshalJSON() ([]byte, error) {
+	return json.Marshal(msg.Fields)
 }
@@ -0,0 +1,385 @@
+package EDDNClient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Outbox sends messages with an Uploader, keeping every message in a
+// directory on disk until the gateway has accepted it, so that nothing is
+// lost while the gateway can't be reached.  Messages are validated, and
+// written to the directory, before they are sent, and removed once the
+// gateway replies "OK" or rejects them outright.  Replay sends the messages
+// left over, such as those stored by an earlier run, oldest first.
+//
+// Each message is stored in a file of its own, named for when it was
+// stored.  Should the Outbox grow beyond OutboxOptions.MaxSize the oldest
+// messages are dropped to make room, and messages older than
+// OutboxOptions.MaxAge are dropped rather than sent; Dropped counts both.  A
+// message larger than MaxSize is sent without being stored, and is dropped
+// should it need keeping.
+//
+// Only one Outbox may use a directory at a time.  An Outbox is safe for
+// concurrent use.
+type Outbox struct {
+	uploader *Uploader
+	dir      string
+	opts     OutboxOptions
+
+	mu       sync.Mutex
+	sending  map[string]bool // Files claimed for sending, which are left alone
+	lastName int64           // Time in the name of the newest file
+	dropped  uint64          // Messages dropped by the limits
+}
+
+// OutboxOptions limits what an Outbox stores.
+type OutboxOptions struct {
+	MaxSize int64         // Bytes stored before the oldest messages are dropped.  Zero is unlimited.
+	MaxAge  time.Duration // Age at which stored messages are dropped, unsent.  Zero is unlimited.
+}
+
+// outboxSuffix ends the name of every message file in an Outbox.
+const outboxSuffix = ".json"
+
+// outboxEntry is a single message file in an Outbox.
+type outboxEntry struct {
+	name   string
+	stored time.Time
+	size   int64
+}
+
+// NewOutbox creates an Outbox sending with uploader, and storing messages in
+// dir, which is created if need be.  Messages already in dir are only sent
+// by Replay.
+func NewOutbox(uploader *Uploader, dir string,
+	opts OutboxOptions) (outbox *Outbox, err error) {
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Anything half written when an earlier run stopped is of no use.
+	partial, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range partial {
+		os.Remove(name)
+	}
+
+	outbox = &Outbox{uploader: uploader, dir: dir, opts: opts,
+		sending: make(map[string]bool)}
+
+	// Listing the messages already stored finds the newest name, which new
+	// ones must sort after.
+	if _, err = outbox.entries(); err != nil {
+		return nil, err
+	}
+
+	return outbox, nil
+}
+
+// Send stores, and then sends, the message body msg as Uploader.Send would.
+func (outbox *Outbox) Send(msg interface{}) (err error) {
+	return outbox.SendContext(context.Background(), msg)
+}
+
+// SendContext stores, and then sends, the message body msg as
+// Uploader.SendContext would.  Invalid messages are neither stored nor sent.
+// Should sending fail with an error the Uploader would retry, such as an
+// *ErrTransport, the error is returned but the message is kept for Replay.
+func (outbox *Outbox) SendContext(ctx context.Context, msg interface{}) (err error) {
+	data, err := outbox.uploader.prepare(msg)
+
+	if err != nil {
+		return err
+	}
+
+	if outbox.opts.MaxSize > 0 && int64(len(data)) > outbox.opts.MaxSize {
+		return outbox.sendUnstored(ctx, data)
+	}
+
+	name, err := outbox.store(data)
+
+	if err != nil {
+		return err
+	}
+
+	return outbox.send(ctx, name, data)
+}
+
+// Replay sends every message stored in the Outbox, oldest first, other than
+// those being sent by SendContext.  It stops at the first message that
+// should be kept for later, returning its error, or once ctx is done.
+// Messages older than MaxAge are dropped instead.
+func (outbox *Outbox) Replay(ctx context.Context) (err error) {
+	outbox.mu.Lock()
+	entries, err := outbox.entries()
+	outbox.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if outbox.expired(entry) {
+			outbox.drop(entry.name)
+			continue
+		}
+
+		if !outbox.claim(entry.name) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(outbox.dir, entry.name))
+
+		if err != nil {
+			outbox.release(entry.name)
+
+			// Messages sent, or dropped, since the directory was listed are
+			// simply skipped.
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if err = outbox.send(ctx, entry.name, data); err != nil && retryable(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the number of messages stored, but not yet sent, leaving
+// out those being sent at the time.
+func (outbox *Outbox) Pending() (pending int, err error) {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	entries, err := outbox.entries()
+
+	for _, entry := range entries {
+		if !outbox.sending[entry.name] {
+			pending++
+		}
+	}
+
+	return pending, err
+}
+
+// Dropped returns the number of messages dropped, unsent, for exceeding the
+// size or age limits.
+func (outbox *Outbox) Dropped() uint64 {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	return outbox.dropped
+}
+
+// claim marks the stored message name as being sent, so that nothing else
+// sends, or drops, it.  It returns false if it is already being sent.
+func (outbox *Outbox) claim(name string) bool {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	if outbox.sending[name] {
+		return false
+	}
+
+	outbox.sending[name] = true
+
+	return true
+}
+
+// release undoes claim.
+func (outbox *Outbox) release(name string) {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	delete(outbox.sending, name)
+}
+
+// send sends data, stored as the claimed message name, and removes it
+// unless it should be kept for Replay.
+func (outbox *Outbox) send(ctx context.Context, name string, data []byte) (err error) {
+	defer outbox.release(name)
+
+	err = outbox.uploader.sendMessage(ctx, data)
+
+	if err != nil && (retryable(err) || ctx.Err() != nil) {
+		return err
+	}
+
+	removeErr := os.Remove(filepath.Join(outbox.dir, name))
+
+	if err == nil && removeErr != nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+
+	return err
+}
+
+// sendUnstored sends data, a message too large for the Outbox to store,
+// counting it as dropped should it need keeping for Replay.
+func (outbox *Outbox) sendUnstored(ctx context.Context, data []byte) (err error) {
+	err = outbox.uploader.sendMessage(ctx, data)
+
+	if err != nil && (retryable(err) || ctx.Err() != nil) {
+		outbox.mu.Lock()
+		outbox.dropped++
+		outbox.mu.Unlock()
+	}
+
+	return err
+}
+
+// store writes data to a new file, first dropping the oldest messages
+// should it not fit within MaxSize, and returns the file's name, claimed.
+// data must not itself be larger than MaxSize.
+func (outbox *Outbox) store(data []byte) (name string, err error) {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	if outbox.opts.MaxSize > 0 {
+		entries, err := outbox.entries()
+
+		if err != nil {
+			return "", err
+		}
+
+		size := int64(len(data))
+
+		for _, entry := range entries {
+			size += entry.size
+		}
+
+		for _, entry := range entries {
+			if size <= outbox.opts.MaxSize {
+				break
+			}
+
+			if outbox.sending[entry.name] {
+				continue
+			}
+
+			if err = os.Remove(filepath.Join(outbox.dir, entry.name)); err == nil {
+				outbox.dropped++
+				size -= entry.size
+			}
+		}
+	}
+
+	// Names are the time stored, in nanoseconds, kept unique and increasing
+	// so that they sort in the order stored.
+	stored := time.Now().UnixNano()
+
+	if stored <= outbox.lastName {
+		stored = outbox.lastName + 1
+	}
+
+	outbox.lastName = stored
+	name = fmt.Sprintf("%020d%s", stored, outboxSuffix)
+
+	// The file is written under a temporary name, and renamed once complete,
+	// so that Replay never sees part of a message.
+	file, err := ioutil.TempFile(outbox.dir, "."+name+"-*.tmp")
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(data)
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(outbox.dir, name))
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	outbox.sending[name] = true
+
+	return name, nil
+}
+
+// entries lists the messages in the Outbox, oldest first.  outbox.mu must
+// be held.
+func (outbox *Outbox) entries() (entries []outboxEntry, err error) {
+	files, err := ioutil.ReadDir(outbox.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+
+		if file.IsDir() || !strings.HasSuffix(name, outboxSuffix) {
+			continue
+		}
+
+		stored, err := strconv.ParseInt(strings.TrimSuffix(name, outboxSuffix), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, outboxEntry{name, time.Unix(0, stored), file.Size()})
+
+		if stored > outbox.lastName {
+			outbox.lastName = stored
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	return entries, nil
+}
+
+// expired reports whether entry is older than MaxAge.
+func (outbox *Outbox) expired(entry outboxEntry) bool {
+	return outbox.opts.MaxAge > 0 && time.Since(entry.stored) > outbox.opts.MaxAge
+}
+
+// drop removes the stored message name, counting it as dropped.
+func (outbox *Outbox) drop(name string) {
+	outbox.mu.Lock()
+	defer outbox.mu.Unlock()
+
+	if outbox.sending[name] {
+		return
+	}
+
+	if err := os.Remove(filepath.Join(outbox.dir, name)); err == nil {
+		outbox.dropped++
+	}
+}
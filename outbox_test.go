@@ -0,0 +1,222 @@
+package EDDNClient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testGateway is a stand-in for the EDDN gateway, which can be made to
+// fail, and records the messages it accepts.
+type testGateway struct {
+	mu       sync.Mutex
+	status   int      // Status replied with
+	accepted []string // StationName of each message accepted
+}
+
+func (gateway *testGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+
+	if gateway.status != http.StatusOK {
+		w.WriteHeader(gateway.status)
+		return
+	}
+
+	var msg Blackmarket
+
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	gateway.accepted = append(gateway.accepted, msg.Message.StationName)
+	w.Write([]byte("OK"))
+}
+
+func (gateway *testGateway) setStatus(status int) {
+	gateway.mu.Lock()
+	gateway.status = status
+	gateway.mu.Unlock()
+}
+
+// newTestOutbox returns an Outbox in a new directory, sending to a stand-in
+// gateway without retrying.
+func newTestOutbox(t *testing.T, opts OutboxOptions) (outbox *Outbox,
+	gateway *testGateway, server *httptest.Server, dir string) {
+
+	gateway = &testGateway{status: http.StatusServiceUnavailable}
+	server = httptest.NewServer(gateway)
+
+	dir, err := ioutil.TempDir("", "eddn-outbox-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outbox, err = NewOutbox(newTestUploader(t, server), dir, opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return outbox, gateway, server, dir
+}
+
+func newTestUploader(t *testing.T, server *httptest.Server) *Uploader {
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL: server.URL,
+		Client:     server.Client(),
+		MaxRetries: -1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return uploader
+}
+
+// sendStations sends a blackmarket message for each station to outbox.
+func sendStations(outbox *Outbox, stations ...string) (err error) {
+	for _, station := range stations {
+		msg := testBlackmarket()
+		msg.StationName = station
+
+		if err = outbox.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestOutboxReplay(t *testing.T) {
+	outbox, gateway, server, dir := newTestOutbox(t, OutboxOptions{})
+
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	// Messages the gateway can't take are kept...
+	for _, station := range []string{"Alpha", "Beta", "Gamma"} {
+		if err := sendStations(outbox, station); !retryable(err) {
+			t.Fatalf("got %v sending to an unavailable gateway", err)
+		}
+	}
+
+	// ...but those it refuses, and invalid ones, aren't.
+	gateway.setStatus(http.StatusBadRequest)
+
+	if err := sendStations(outbox, "Delta", ""); err == nil {
+		t.Fatal("refused messages were sent")
+	}
+
+	if pending, err := outbox.Pending(); err != nil || pending != 3 {
+		t.Fatalf("got %d pending messages, %v", pending, err)
+	}
+
+	// Another Outbox using the directory, as after a restart, replays them
+	// in the order they were stored.
+	gateway.setStatus(http.StatusOK)
+
+	restarted, err := NewOutbox(newTestUploader(t, server), dir, OutboxOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = restarted.Replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = sendStations(restarted, "Epsilon"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Alpha", "Beta", "Gamma", "Epsilon"}
+
+	if len(gateway.accepted) != len(want) {
+		t.Fatalf("gateway accepted %v, want %v", gateway.accepted, want)
+	}
+
+	for i := range want {
+		if gateway.accepted[i] != want[i] {
+			t.Fatalf("gateway accepted %v, want %v", gateway.accepted, want)
+		}
+	}
+
+	if pending, err := restarted.Pending(); err != nil || pending != 0 {
+		t.Errorf("got %d pending messages, %v", pending, err)
+	}
+}
+
+func TestOutboxLimits(t *testing.T) {
+	outbox, gateway, server, dir := newTestOutbox(t, OutboxOptions{MaxAge: time.Hour})
+
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	data, err := outbox.uploader.prepare(testBlackmarket())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There is room for two messages, and a bit.
+	outbox.opts.MaxSize = int64(len(data)) * 5 / 2
+
+	for _, station := range []string{"Alpha", "Beta", "Gamma", "Delta"} {
+		sendStations(outbox, station)
+	}
+
+	if pending, _ := outbox.Pending(); pending != 2 || outbox.Dropped() != 2 {
+		t.Fatalf("got %d pending, and %d dropped, messages", pending, outbox.Dropped())
+	}
+
+	// A message larger than MaxSize is dropped, unstored, rather than making
+	// room for it.
+	outbox.opts.MaxSize = int64(len(data)) / 2
+
+	if err = sendStations(outbox, "Epsilon"); !retryable(err) {
+		t.Fatalf("got %v sending to an unavailable gateway", err)
+	}
+
+	if pending, _ := outbox.Pending(); pending != 2 || outbox.Dropped() != 3 {
+		t.Fatalf("got %d pending, and %d dropped, messages", pending, outbox.Dropped())
+	}
+
+	// Messages being sent aren't pending.
+	entries, err := outbox.entries()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outbox.claim(entries[0].name)
+
+	if pending, _ := outbox.Pending(); pending != 1 {
+		t.Fatalf("got %d pending messages while one is sent", pending)
+	}
+
+	outbox.release(entries[0].name)
+
+	// Those too old are dropped rather than sent.
+	gateway.setStatus(http.StatusOK)
+	outbox.opts.MaxAge = time.Nanosecond
+
+	if err = outbox.Replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, _ := outbox.Pending(); pending != 0 || outbox.Dropped() != 5 ||
+		len(gateway.accepted) != 0 {
+		t.Errorf("got %d pending, %d dropped, and %d sent messages", pending,
+			outbox.Dropped(), len(gateway.accepted))
+	}
+}
@@ -2,15 +2,20 @@ package EDDNClient
 
 // OutfittingMessage contains the outfitting data sent to EDDN.
 type OutfittingMessage struct {
-	Modules     []string `json:"modules"`     // Required
-	StationName string   `json:"stationName"` // Required
-	SystemName  string   `json:"systemName"`  // Required
-	Timestamp   string   `json:"timestamp"`   // Required
+	Modules     []string  `json:"modules"`     // Required
+	StationName string    `json:"stationName"` // Required
+	SystemName  string    `json:"systemName"`  // Required
+	Timestamp   Timestamp `json:"timestamp"`   // Required
+	Extras                // Fields not otherwise decoded, see Extras
 }
 
 // Outfitting is the high level type that contains the entire JSON message.
+// Messages received using the legacy outfitting/1 schema are upgraded to this
+// one, and record the version they were sent as in SourceVersion.
 type Outfitting struct {
-	SchemaRef string            `json:"$schemaRef"`
-	Header    Header            `json:"header"`
-	Message   OutfittingMessage `json:"message"`
+	SchemaRef     string            `json:"$schemaRef"`
+	Header        Header            `json:"header"`
+	Message       OutfittingMessage `json:"message"`
+	Extras                          // Fields not otherwise decoded, see Extras
+	SourceVersion string            `json:"-"` // Version upgraded from, if received as a legacy schema
 }
@@ -0,0 +1,218 @@
+package EDDNClient
+
+import (
+	"strings"
+)
+
+// OutfittingV1Module is a single module in an OutfittingV1Message, which
+// the outfitting/1 schema described by its display name and attributes
+// rather than by symbol.
+type OutfittingV1Module struct {
+	Category    string `json:"category"`              // Such as "hardpoint", "utility", "standard", or "internal"
+	Class       string `json:"class"`                 // Module class, "0" to "8"
+	Entitlement string `json:"entitlement,omitempty"` // Faction or rank needed to buy the module
+	Guidance    string `json:"guidance,omitempty"`    // "Dumbfire" or "Seeker", for missiles
+	Mount       string `json:"mount,omitempty"`       // "Fixed", "Gimballed", or "Turreted", for weapons
+	Name        string `json:"name"`                  // Display name, such as "Pulse Laser"
+	Rating      string `json:"rating"`                // Module rating, "A" to "I"
+	Ship        string `json:"ship,omitempty"`        // The ship, for bulkheads
+	Extras             // Fields not otherwise decoded, see Extras
+}
+
+// OutfittingV1Message is the message body of the outfitting/1 schema.
+type OutfittingV1Message struct {
+	Modules     []OutfittingV1Module `json:"modules"`
+	StationName string               `json:"stationName"`
+	SystemName  string               `json:"systemName"`
+	Timestamp   Timestamp            `json:"timestamp"`
+	Extras                           // Fields not otherwise decoded, see Extras
+}
+
+// OutfittingV1 is a whole outfitting/1 message.
+type OutfittingV1 struct {
+	SchemaRef string              `json:"$schemaRef"`
+	Header    Header              `json:"header"`
+	Message   OutfittingV1Message `json:"message"`
+	Extras                        // Fields not otherwise decoded, see Extras
+}
+
+// outfittingV2URI is the $schemaRef of the current outfitting schema, which
+// legacy messages are upgraded to.
+const outfittingV2URI = "http://schemas.elite-markets.net/eddn/outfitting/2"
+
+// fixedModuleSymbols maps the display names of modules that come in only
+// one size to their whole symbol.
+var fixedModuleSymbols = map[string]string{
+	"Advanced Discovery Scanner":     "Int_StellarBodyDiscoveryScanner_Advanced",
+	"Basic Discovery Scanner":        "Int_StellarBodyDiscoveryScanner_Standard",
+	"Chaff Launcher":                 "Hpt_ChaffLauncher_Tiny",
+	"Electronic Countermeasure":      "Hpt_ElectronicCountermeasure_Tiny",
+	"Heat Sink Launcher":             "Hpt_HeatSinkLauncher_Turret_Tiny",
+	"Intermediate Discovery Scanner": "Int_StellarBodyDiscoveryScanner_Intermediate",
+	"Point Defence":                  "Hpt_PlasmaPointDefence_Turret_Tiny",
+	"Standard Docking Computer":      "Int_DockingComputer_Standard",
+}
+
+// weaponSymbols maps the display names of weapons to the stem of their
+// symbol, which is completed by the mount and size.
+var weaponSymbols = map[string]string{
+	"Beam Laser":         "BeamLaser",
+	"Burst Laser":        "PulseLaserBurst",
+	"Cannon":             "Cannon",
+	"Fragment Cannon":    "Slugshot",
+	"Mine Launcher":      "MineLauncher",
+	"Mining Laser":       "MiningLaser",
+	"Multi-Cannon":       "MultiCannon",
+	"Plasma Accelerator": "PlasmaAccelerator",
+	"Pulse Laser":        "PulseLaser",
+	"Rail Gun":           "Railgun",
+	"Torpedo Pylon":      "AdvancedTorpPylon",
+}
+
+// utilitySymbols maps the display names of utility modules to the stem of
+// their symbol, which is completed by the rating.
+var utilitySymbols = map[string]string{
+	"Cargo Scanner":            "CargoScanner",
+	"Frame Shift Wake Scanner": "CloudScanner",
+	"Kill Warrant Scanner":     "CrimeScanner",
+	"Shield Booster":           "ShieldBooster",
+}
+
+// internalSymbols maps the display names of standard and optional internal
+// modules to the stem of their symbol, which is completed by the class and
+// rating.
+var internalSymbols = map[string]string{
+	"Auto Field-Maintenance Unit":     "Repairer",
+	"Cargo Rack":                      "CargoRack",
+	"Collector Limpet Controller":     "DroneControl_Collection",
+	"Detailed Surface Scanner":        "DetailedSurfaceScanner",
+	"Frame Shift Drive":               "Hyperdrive",
+	"Frame Shift Drive Interdictor":   "FSDInterdictor",
+	"Fuel Scoop":                      "FuelScoop",
+	"Fuel Tank":                       "FuelTank",
+	"Fuel Transfer Limpet Controller": "DroneControl_FuelTransfer",
+	"Hatch Breaker Limpet Controller": "DroneControl_ResourceSiphon",
+	"Hull Reinforcement Package":      "HullReinforcement",
+	"Life Support":                    "LifeSupport",
+	"Planetary Vehicle Hangar":        "BuggyBay",
+	"Power Distributor":               "PowerDistributor",
+	"Power Plant":                     "Powerplant",
+	"Prospector Limpet Controller":    "DroneControl_Prospector",
+	"Refinery":                        "Refinery",
+	"Sensors":                         "Sensors",
+	"Shield Cell Bank":                "ShieldCellBank",
+	"Shield Generator":                "ShieldGenerator",
+	"Thrusters":                       "Engine",
+}
+
+// armourGrades maps the display names of bulkheads to the grade ending
+// their symbol.
+var armourGrades = map[string]string{
+	"Lightweight Alloy":          "Grade1",
+	"Reinforced Alloy":           "Grade2",
+	"Military Grade Composite":   "Grade3",
+	"Mirrored Surface Composite": "Mirrored",
+	"Reactive Surface Composite": "Reactive",
+}
+
+// mountSymbols maps weapon mounts to their part of the symbol.
+var mountSymbols = map[string]string{
+	"Fixed":     "Fixed",
+	"Gimballed": "Gimbal",
+	"Turreted":  "Turret",
+}
+
+// hardpointSizes maps weapon classes to their part of the symbol.
+var hardpointSizes = map[string]string{
+	"1": "Small",
+	"2": "Medium",
+	"3": "Large",
+	"4": "Huge",
+}
+
+// ratingClasses maps module ratings to the class used in their symbol.
+var ratingClasses = map[string]string{
+	"A": "5",
+	"B": "4",
+	"C": "3",
+	"D": "2",
+	"E": "1",
+}
+
+// Symbol returns the symbol the outfitting/2 schema uses for the module,
+// such as "Hpt_PulseLaser_Fixed_Small" or "Int_Engine_Size3_Class5".
+// Modules not known are named by their display name without spaces, so no
+// module is lost.
+func (module OutfittingV1Module) Symbol() string {
+	if symbol, ok := fixedModuleSymbols[module.Name]; ok {
+		return symbol
+	}
+
+	if grade, ok := armourGrades[module.Name]; ok && module.Ship != "" {
+		return shipSymbol(module.Ship) + "_Armour_" + grade
+	}
+
+	if module.Name == "Missile Rack" {
+		stem := "DumbfireMissileRack"
+
+		if module.Guidance == "Seeker" {
+			stem = "BasicMissileRack"
+		}
+
+		return "Hpt_" + stem + "_" + mountSymbols[module.Mount] + "_" +
+			hardpointSizes[module.Class]
+	}
+
+	if stem, ok := weaponSymbols[module.Name]; ok {
+		return "Hpt_" + stem + "_" + mountSymbols[module.Mount] + "_" +
+			hardpointSizes[module.Class]
+	}
+
+	if stem, ok := utilitySymbols[module.Name]; ok {
+		return "Hpt_" + stem + "_Size0_Class" + ratingClasses[module.Rating]
+	}
+
+	if stem, ok := internalSymbols[module.Name]; ok {
+		return "Int_" + stem + "_Size" + module.Class + "_Class" +
+			ratingClasses[module.Rating]
+	}
+
+	return strings.Replace(module.Name, " ", "", -1)
+}
+
+// Upgrade converts msg to the current outfitting schema, translating every
+// module to its symbol.  The message's Extra fields are kept in those of the
+// result, but those of the modules, which become plain symbols, are not.
+func (msg OutfittingV1) Upgrade() Outfitting {
+	modules := make([]string, len(msg.Message.Modules))
+
+	for i, module := range msg.Message.Modules {
+		modules[i] = module.Symbol()
+	}
+
+	return Outfitting{
+		SchemaRef: outfittingV2URI,
+		Header:    msg.Header,
+		Extras:    Extras{Extra: msg.Extra},
+		Message: OutfittingMessage{
+			Modules:     modules,
+			StationName: msg.Message.StationName,
+			SystemName:  msg.Message.SystemName,
+			Timestamp:   msg.Message.Timestamp,
+			Extras:      Extras{Extra: msg.Message.Extra},
+		},
+		SourceVersion: "1",
+	}
+}
+
+// decodeOutfittingV1 is the SchemaDefinition.Decode for outfitting/1, which
+// delivers the message upgraded to an Outfitting.
+func decodeOutfittingV1(data []byte) (msg interface{}, err error) {
+	var legacy OutfittingV1
+
+	if err = decodeExtras(data, &legacy); decodeFailed(err) {
+		return nil, err
+	}
+
+	return legacy.Upgrade(), err
+}
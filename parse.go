@@ -1,19 +1,46 @@
 package EDDNClient
 
 import (
+	"bytes"
 	"compress/zlib"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/mitchellh/mapstructure"
+	"io"
 	"io/ioutil"
+	"reflect"
 	"strings"
+	"sync"
 )
 
 var (
 	errUnhandledSchema = errors.New("schema not supported")
+
+	// errFiltered is returned for messages rejected by a prefilter.  It is
+	// never reported to the receiver.
+	errFiltered = errors.New("message filtered")
 )
 
+// parseSchemaRef splits a $schemaRef such as
+// "http://schemas.elite-markets.net/eddn/journal/1/test" into its family
+// ("journal"), version ("1"), and whether it is a test schema.  Only the
+// final path segments are considered, so schemas hosted elsewhere split in
+// the same way.
+func parseSchemaRef(schemaRef string) (family string, version string, test bool) {
+	parts := strings.Split(strings.TrimSuffix(schemaRef, "/"), "/")
+
+	if len(parts) > 0 && parts[len(parts)-1] == "test" {
+		test = true
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) > 1 {
+		family, version = parts[len(parts)-2], parts[len(parts)-1]
+	}
+
+	return family, version, test
+}
+
 // Root is the root of every JSON message received from EDDN.  This should
 // not be used directly as this is lazily parsed to find the schema first.
 type Root struct {
@@ -30,80 +57,361 @@ type Header struct {
 	SoftwareName     string `json:"softwareName"`               // Software that sent the data
 	SoftwareVersion  string `json:"softwareVersion"`            // Software version
 	UploaderID       string `json:"uploaderID"`                 // ID of the uploader
+	Extras                  // Fields not otherwise decoded, see Extras
 }
 
-func handleJournalMessage(msg interface{}) (out interface{}, err error) {
+// zlibReaders holds zlib readers for reuse, as each one carries a sizeable
+// window that would otherwise be allocated for every message.
+var zlibReaders sync.Pool
 
-	if journalMsg, ok := msg.(map[string]interface{}); ok {
+// newZlibReader returns a zlib reader, from zlibReaders if possible, reading
+// from data.  It should be returned to zlibReaders once finished with.
+func newZlibReader(data string) (r io.ReadCloser, err error) {
+	if pooled, ok := zlibReaders.Get().(io.ReadCloser); ok {
+		if err = pooled.(zlib.Resetter).Reset(strings.NewReader(data), nil); err != nil {
+			return nil, err
+		}
+
+		return pooled, nil
+	}
 
-		if event, ok := journalMsg["event"]; ok {
+	return zlib.NewReader(strings.NewReader(data))
+}
 
-			switch event {
-			case "FSDJump":
-				var jumpMsg JournalFSDJump
-				err := mapstructure.Decode(journalMsg, &jumpMsg)
+// peekChunkSize limits how much is decompressed at a time while peeking, so
+// that filtered messages are decompressed no further than necessary.
+const peekChunkSize = 256
 
-				if err != nil {
-					return nil, err
-				}
+// chunkReader reads from r no more than size bytes at a time.
+type chunkReader struct {
+	r    io.Reader
+	size int
+}
 
-				return jumpMsg, nil
+func (c *chunkReader) Read(p []byte) (n int, err error) {
+	if len(p) > c.size {
+		p = p[:c.size]
+	}
 
-			case "Docked":
-				var dockedMsg JournalDocked
-				err := mapstructure.Decode(journalMsg, &dockedMsg)
+	return c.r.Read(p)
+}
 
-				if err != nil {
-					return nil, err
-				}
+// peekMessage reads just enough of the JSON message in r to fill in a
+// MessageInfo, stopping as soon as it is complete.  Most messages put
+// $schemaRef and the header first, so usually little of the message body is
+// read, or decompressed.
+func peekMessage(r io.Reader) (info *MessageInfo, err error) {
+	decoder := json.NewDecoder(r)
+	info = &MessageInfo{}
 
-				return dockedMsg, nil
+	var sawHeader, sawMessage bool
 
-			case "Scan":
-				// Check if it's a star, or a body.
-				if _, ok := journalMsg["StarType"]; ok {
-					var scanMsg JournalScanStar
-					err := mapstructure.Decode(journalMsg, &scanMsg)
+	if err = expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
 
-					if err != nil {
-						return nil, err
-					}
+	for decoder.More() && !(info.SchemaRef != "" && sawHeader && sawMessage) {
+		key, err := decoder.Token()
 
-					return scanMsg, nil
-				}
+		if err != nil {
+			return nil, err
+		}
 
-				// We have a body
-				var scanMsg JournalScanPlanet
-				err := mapstructure.Decode(journalMsg, &scanMsg)
+		switch key {
+		case "$schemaRef":
+			err = decoder.Decode(&info.SchemaRef)
+			info.Family, info.Version, info.Test = parseSchemaRef(info.SchemaRef)
 
-				if err != nil {
-					return nil, err
-				}
+		case "header":
+			var header Header
+			err = decoder.Decode(&header)
 
-				return scanMsg, nil
+			info.SoftwareName = header.SoftwareName
+			info.SoftwareVersion = header.SoftwareVersion
+			info.UploaderID = header.UploaderID
+			sawHeader = true
 
-			default:
-				return nil, errors.New("invalid event, or event not found")
-			}
+		case "message":
+			// The rest of the body can only be left unread if nothing else
+			// remains to be read after it.
+			err = peekBody(decoder, info, info.SchemaRef != "" && sawHeader)
+			sawMessage = true
 
+		default:
+			err = skipValue(decoder)
 		}
 
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil, errors.New("msg is not a Journal type")
+	return info, nil
 }
 
-func parseJSON(data string) (parsed interface{}, err error) {
-	r, _ := zlib.NewReader(strings.NewReader(data))
-	defer r.Close()
+// peekBody reads the message body from decoder into info.  If last is true
+// it stops as soon as info is complete, leaving the rest of the body unread.
+func peekBody(decoder *json.Decoder, info *MessageInfo, last bool) (err error) {
+	complete := func() bool {
+		if info.Family == "journal" {
+			return info.Event != "" && info.SystemName != "" && info.HasStarPos
+		}
+
+		return info.SystemName != ""
+	}
+
+	if err = expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "event":
+			err = decoder.Decode(&info.Event)
+		case "StarSystem", "System", "systemName":
+			err = decoder.Decode(&info.SystemName)
+		case "StarPos":
+			var pos []float64
+			err = decoder.Decode(&pos)
+
+			// A StarPos that isn't coordinates is left for decoding to report.
+			var typeErr *json.UnmarshalTypeError
+
+			if errors.As(err, &typeErr) {
+				err = nil
+			} else if err == nil && len(pos) == 3 {
+				info.HasStarPos = true
+				copy(info.StarPos[:], pos)
+			}
+		default:
+			err = skipValue(decoder)
+		}
+
+		if err != nil {
+			return err
+		}
 
-	output, err := ioutil.ReadAll(r)
+		if last && complete() {
+			return nil
+		}
+	}
+
+	_, err = decoder.Token()
+
+	return err
+}
+
+// expectDelim reads the next token from decoder, which must be delim.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
 
 	if err != nil {
-		fmt.Printf("Error: %v", err)
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+
+	return nil
+}
+
+// skipValue reads, and discards, the next value from decoder.
+func skipValue(decoder *json.Decoder) error {
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// messageEnvelope returns the $schemaRef, and header, of a message returned
+// by parseJSON.
+func messageEnvelope(msg interface{}) (schemaRef string, header Header) {
+	switch msg := msg.(type) {
+	case Journal:
+		return msg.SchemaRef, msg.Header
+	case Shipyard:
+		return msg.SchemaRef, msg.Header
+	case Commodity:
+		return msg.SchemaRef, msg.Header
+	case Blackmarket:
+		return msg.SchemaRef, msg.Header
+	case Outfitting:
+		return msg.SchemaRef, msg.Header
+	}
+
+	// Messages of schemas registered by the application are expected to
+	// follow the same pattern.
+	value := reflect.ValueOf(msg)
+
+	if value.Kind() == reflect.Struct {
+		if field := value.FieldByName("SchemaRef"); field.Kind() == reflect.String {
+			schemaRef = field.String()
+		}
+
+		if field := value.FieldByName("Header"); field.IsValid() {
+			header, _ = field.Interface().(Header)
+		}
+	}
+
+	return schemaRef, header
+}
+
+// handleJournalMessage decodes the body of a journal message into the type
+// for its event, straight from the JSON.  Events without a type of their
+// own are returned as a JournalUnknown.
+func handleJournalMessage(data json.RawMessage) (out interface{}, err error) {
+	if len(data) == 0 || data[0] != '{' {
+		return nil, errors.New("msg is not a Journal type")
+	}
+
+	var discriminator struct {
+		Event    string          `json:"event"`
+		StarType json.RawMessage `json:"StarType"`
+	}
+
+	if err = json.Unmarshal(data, &discriminator); err != nil {
+		return nil, err
+	}
+
+	if discriminator.Event == "" {
+		return nil, errors.New("event not found")
+	}
+
+	decode := func(out interface{}) (interface{}, error) {
+		err := decodeExtras(data, out)
+
+		if decodeFailed(err) {
+			return nil, err
+		}
+
+		return reflect.ValueOf(out).Elem().Interface(), err
+	}
+
+	switch discriminator.Event {
+	case "FSDJump":
+		return decode(&JournalFSDJump{})
+
+	case "Docked":
+		return decode(&JournalDocked{})
+
+	case "Scan":
+		// Check if it's a star, or a body.
+		if discriminator.StarType != nil {
+			return decode(&JournalScanStar{})
+		}
+
+		// We have a body
+		return decode(&JournalScanPlanet{})
+
+	case "Location":
+		return decode(&JournalLocation{})
+
+	case "CarrierJump":
+		return decode(&JournalCarrierJump{})
+
+	case "SAASignalsFound":
+		return decode(&JournalSAASignalsFound{})
+
+	case "CodexEntry":
+		return decode(&JournalCodexEntry{})
+	}
+
+	// Numbers are kept as json.Number, as IDs such as SystemAddress and
+	// MarketID may be too large for a float64 to hold exactly.
+	var fields map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&fields); err != nil {
 		return nil, err
 	}
 
+	return JournalUnknown{discriminator.Event, fields}, nil
+}
+
+// parseJSON decompresses, and decodes using the schemas in registry, a
+// message received from the relay.  Messages not matched by wanted, if it
+// isn't nil, are not decoded and errFiltered is returned.  Messages using a
+// /test schema are only decoded if test is true, and messages are validated
+// according to validation as for decodeJSON.  Any other error returned is a
+// *MessageError describing where decoding failed.
+func parseJSON(data string, wanted Filter, registry *SchemaRegistry,
+	test bool, validation ValidationMode) (parsed interface{}, err error) {
+	r, err := newZlibReader(data)
+
+	if err != nil {
+		return nil, &MessageError{Kind: ErrorDecompress, Payload: []byte(data),
+			Err: err}
+	}
+
+	defer zlibReaders.Put(r)
+
+	// Everything decompressed while peeking is kept so that wanted messages
+	// needn't be decompressed twice.
+	var output bytes.Buffer
+	tee := io.TeeReader(r, &output)
+
+	if wanted != nil {
+		info, err := peekMessage(&chunkReader{tee, peekChunkSize})
+
+		// Anything that couldn't be peeked at is left for the full decode to
+		// report.
+		if err == nil && !wanted.Match(info) {
+			return nil, errFiltered
+		}
+	}
+
+	if _, err = io.Copy(ioutil.Discard, tee); err != nil {
+		return nil, &MessageError{Kind: ErrorDecompress, Payload: []byte(data),
+			Err: err}
+	}
+
+	parsed, err = decodeJSON(output.Bytes(), registry, test, validation)
+
+	if msgErr, ok := err.(*MessageError); ok {
+		msgErr.Payload = []byte(data)
+	}
+
+	return parsed, err
+}
+
+// decodeJSON decodes an uncompressed message using the schemas in registry,
+// rejecting those using a /test schema unless acceptTest is true.  Any error
+// returned is a *MessageError describing where decoding failed.  Messages
+// failing validation are returned along with the error when validation is
+// ValidationFlag, and those with fields that could not be decoded along with
+// an error of kind ErrorField.
+func decodeJSON(output []byte, registry *SchemaRegistry, acceptTest bool,
+	validation ValidationMode) (parsed interface{}, err error) {
+	fail := func(kind ErrorKind, schemaRef string, output []byte,
+		err error) (interface{}, error) {
+		return nil, &MessageError{kind, schemaRef, nil, output, err}
+	}
+
 	// Parse the schema to find out what kind of message we're going to be
 	// handling.
 	var jsonData Root
@@ -111,73 +419,174 @@ func parseJSON(data string) (parsed interface{}, err error) {
 	err = json.Unmarshal(output, &jsonData)
 
 	if err != nil {
-		fmt.Println("Error: ", err)
-		return nil, err
+		return fail(ErrorJSON, "", output, err)
 	}
 
-	switch jsonData.SchemaRef {
-	case "http://schemas.elite-markets.net/eddn/commodity/1":
-		fallthrough
-	case "http://schemas.elite-markets.net/eddn/commodity/2":
-		err := errors.New("commodity versions 1 and 2 not currently supported")
-		return nil, err
+	def, test, ok := registry.Lookup(jsonData.SchemaRef)
 
-	case "http://schemas.elite-markets.net/eddn/commodity/3":
-		var commodityData Commodity
-		json.Unmarshal(output, &commodityData)
-		return commodityData, nil
+	if !ok {
+		return fail(ErrorUnsupportedSchema, jsonData.SchemaRef, output,
+			errUnhandledSchema)
+	}
 
-	case "http://schemas.elite-markets.net/eddn/journal/1":
-		var journalData Journal
-		json.Unmarshal(output, &journalData)
+	// Test schemas are disregarded unless asked for.
+	if test && !acceptTest {
+		return fail(ErrorUnsupportedSchema, jsonData.SchemaRef, output,
+			ErrTestSchema)
+	}
 
-		parsedMsg, err := handleJournalMessage(journalData.Message)
+	var invalid error
 
-		if err != nil {
-			return nil, err
+	if validation != ValidationOff {
+		if err = registry.validateReceived(def, output); err != nil {
+			invalid = &MessageError{ErrorValidation, jsonData.SchemaRef, nil, output, err}
+
+			if validation == ValidationDrop {
+				return nil, invalid
+			}
 		}
+	}
 
-		journalData.Message = parsedMsg
+	parsed, err = def.decode(output)
 
-		return journalData, nil
+	if msgErr, ok := err.(*MessageError); ok {
+		msgErr.SchemaRef = jsonData.SchemaRef
+		msgErr.Decompressed = output
+		return nil, msgErr
+	}
 
-	case "http://schemas.elite-markets.net/eddn/outfitting/1":
-		err := errors.New("outfitting version 1 is not currently supported")
-		return nil, err
+	if decodeFailed(err) {
+		return fail(ErrorJSON, jsonData.SchemaRef, output, err)
+	}
+
+	if test {
+		parsed = markTest(parsed)
+	}
+
+	if err != nil && invalid == nil {
+		invalid = &MessageError{ErrorField, jsonData.SchemaRef, nil, output, err}
+	}
+
+	return parsed, invalid
+}
+
+// markTest returns msg with "/test" appended to its SchemaRef, if it isn't
+// there already, so that test messages upgraded from a legacy schema are
+// still recognisable as such.
+func markTest(msg interface{}) interface{} {
+	value := reflect.ValueOf(msg)
+
+	if value.Kind() != reflect.Struct {
+		return msg
+	}
+
+	marked := reflect.New(value.Type()).Elem()
+	marked.Set(value)
 
-	case "http://schemas.elite-markets.net/eddn/outfitting/2":
-		var outfittingData Outfitting
-		json.Unmarshal(output, &outfittingData)
-		return outfittingData, nil
+	field := marked.FieldByName("SchemaRef")
 
-	case "http://schemas.elite-markets.net/eddn/blackmarket/1":
-		var blackmarketData Blackmarket
-		json.Unmarshal(output, &blackmarketData)
-		return blackmarketData, nil
+	if field.Kind() != reflect.String || IsTestSchema(field.String()) {
+		return msg
+	}
+
+	field.SetString(field.String() + "/test")
+
+	return marked.Interface()
+}
+
+// IsTestSchema reports whether schemaRef is one of the /test schemas, which
+// are only received when ChannelOptions.DeliverTest is set.
+func IsTestSchema(schemaRef string) bool {
+	_, _, test := parseSchemaRef(schemaRef)
 
-	case "http://schemas.elite-markets.net/eddn/shipyard/1":
-		err := errors.New("shipyard version 1 is not currently supported")
+	return test
+}
+
+// decodeJournal is the SchemaDefinition.Decode for journal messages, which
+// decodes the message body into the type matching its event.
+func decodeJournal(data []byte) (msg interface{}, err error) {
+	var journalData struct {
+		SchemaRef string          `json:"$schemaRef"`
+		Header    Header          `json:"header"`
+		Message   json.RawMessage `json:"message"`
+		Extras
+	}
+
+	if err = decodeExtras(data, &journalData); decodeFailed(err) {
 		return nil, err
+	}
 
-	case "http://schemas.elite-markets.net/eddn/shipyard/2":
-		var shipyardData Shipyard
-		json.Unmarshal(output, &shipyardData)
-		return shipyardData, nil
+	parsedMsg, msgErr := handleJournalMessage(journalData.Message)
 
-		// Handle special cases with test.  Disregard these.
-	case "http://schemas.elite-markets.net/eddn/shipyard/2/test":
-		fallthrough
-	case "http://schemas.elite-markets.net/eddn/blackmarket/1/test":
-		fallthrough
-	case "http://schemas.elite-markets.net/eddn/outfitting/2/test":
-		fallthrough
-	case "http://schemas.elite-markets.net/eddn/journal/1/test":
-		fallthrough
-	case "http://schemas.elite-markets.net/eddn/commodity/3/test":
-		fallthrough
+	if decodeFailed(msgErr) {
+		return nil, &MessageError{Kind: ErrorJournalDecode, Err: msgErr}
+	}
+
+	if msgErr != nil {
+		err = msgErr
+	}
+
+	return Journal{journalData.SchemaRef, journalData.Header, parsedMsg,
+		journalData.Extras}, err
+}
+
+// ParseMessage decodes a single, uncompressed, EDDN message such as those
+// found in archives or HTTP bodies.  The message returned is one of Journal,
+// Shipyard, Commodity, Blackmarket, or Outfitting.  Any error returned is a
+// *MessageError describing where decoding failed; messages using a /test
+// schema return an error wrapping ErrTestSchema.  A message with fields
+// that could not be decoded is returned along with an error of kind
+// ErrorField, wrapping a *FieldError.
+func ParseMessage(data []byte) (msg interface{}, err error) {
+	return defaultRegistry.ParseMessage(data)
+}
+
+// ParseCompressedMessage decodes a single zlib compressed EDDN message, as
+// sent by the relay, in the same way as ParseMessage.
+func ParseCompressedMessage(data []byte) (msg interface{}, err error) {
+	return defaultRegistry.ParseCompressedMessage(data)
+}
+
+// ReadMessage reads a single EDDN message from r, which may be either zlib
+// compressed or plain JSON, and decodes it in the same way as ParseMessage.
+func ReadMessage(r io.Reader) (msg interface{}, err error) {
+	return defaultRegistry.ReadMessage(r)
+}
+
+// ParseMessage behaves like the package level ParseMessage, but decodes
+// using the schemas in registry.  Messages of schemas registered by the
+// application are returned as a value of their SchemaDefinition.Type.
+func (registry *SchemaRegistry) ParseMessage(data []byte) (msg interface{}, err error) {
+	msg, err = decodeJSON(data, registry, false, ValidationOff)
+
+	if msgErr, ok := err.(*MessageError); ok {
+		msgErr.Payload = data
+	}
+
+	return msg, err
+}
+
+// ParseCompressedMessage behaves like the package level
+// ParseCompressedMessage, but decodes using the schemas in registry.
+func (registry *SchemaRegistry) ParseCompressedMessage(data []byte) (msg interface{}, err error) {
+	return parseJSON(string(data), nil, registry, false, ValidationOff)
+}
+
+// ReadMessage behaves like the package level ReadMessage, but decodes
+// using the schemas in registry.
+func (registry *SchemaRegistry) ReadMessage(r io.Reader) (msg interface{}, err error) {
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, &MessageError{Kind: ErrorTransport, Err: err}
+	}
 
-	default:
-		return nil, errUnhandledSchema
+	// JSON messages always start with an object, and a zlib stream never
+	// starts with '{', or whitespace.
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 &&
+		trimmed[0] == '{' {
+		return registry.ParseMessage(data)
 	}
 
+	return registry.ParseCompressedMessage(data)
 }
@@ -0,0 +1,496 @@
+package EDDNClient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// compress compresses data as the relay does.
+func compress(data []byte) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	return buf.String()
+}
+
+// loadFeed reads the recorded feed in testdata, compressing every message
+// as the relay does.
+func loadFeed(tb testing.TB) (feed []string) {
+	file, err := os.Open("testdata/feed.jsonl")
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		feed = append(feed, compress(scanner.Bytes()))
+	}
+
+	if err = scanner.Err(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return feed
+}
+
+// journalOnly excludes everything but journal messages.
+const journalOnly = FilterShipyard | FilterCommodity | FilterBlackmarket |
+	FilterOutfitting
+
+func TestParseJSONPrefilter(t *testing.T) {
+	wanted := MaskFilter(journalOnly)
+
+	for _, data := range loadFeed(t) {
+		msg, err := parseJSON(data, wanted, defaultRegistry, false, ValidationOff)
+
+		if err == errFiltered || errors.Is(err, ErrTestSchema) {
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := msg.(Journal); !ok {
+			t.Errorf("got %T, want only Journal messages", msg)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	plain, err := ioutil.ReadFile("testdata/feed.jsonl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(plain), []byte("\n"))
+	compressed := loadFeed(t)
+
+	for i, line := range lines {
+		fromPlain, err := ReadMessage(bytes.NewReader(line))
+
+		if errors.Is(err, ErrTestSchema) {
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+
+		fromCompressed, err := ReadMessage(strings.NewReader(compressed[i]))
+
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+
+		if schemaRef, _ := messageEnvelope(fromPlain); schemaRef == "" {
+			t.Errorf("message %d: decoded to %T", i, fromPlain)
+		}
+
+		if !reflect.DeepEqual(fromPlain, fromCompressed) {
+			t.Errorf("message %d: compressed and plain messages differ", i)
+		}
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		kind ErrorKind
+	}{
+		{`not json`, ErrorJSON},
+		{`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3","message":{"commodities":"none"}}`, ErrorJSON},
+		{`{"$schemaRef":"http://schemas.elite-markets.net/eddn/unknown/1","message":{}}`, ErrorUnsupportedSchema},
+		{`{"$schemaRef":"http://schemas.elite-markets.net/eddn/journal/1","message":{"StarSystem":"Sol"}}`, ErrorJournalDecode},
+	}
+
+	for _, test := range tests {
+		_, err := ParseMessage([]byte(test.data))
+
+		var msgErr *MessageError
+
+		if !errors.As(err, &msgErr) {
+			t.Errorf("%s: got %v, want a *MessageError", test.data, err)
+			continue
+		}
+
+		if msgErr.Kind != test.kind {
+			t.Errorf("%s: got %v error, want %v", test.data, msgErr.Kind, test.kind)
+		}
+
+		if string(msgErr.Payload) != test.data {
+			t.Errorf("%s: payload not recorded", test.data)
+		}
+	}
+}
+
+func TestParseLegacyCommodity(t *testing.T) {
+	header := `"header":{"uploaderID":"cmdr","softwareName":"EliteOCR","softwareVersion":"0.6"}`
+
+	tests := []struct {
+		data    string
+		version string
+		want    []Commodities
+	}{
+		{
+			`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/1",` + header + `,` +
+				`"message":{"systemName":"Eranin","stationName":"Azeban City","itemName":"Gold",` +
+				`"buyPrice":9150,"stationStock":320,"supplyLevel":"Med","sellPrice":9010,` +
+				`"demand":0,"timestamp":"2015-02-01T12:00:00+00:00"}}`,
+			"1",
+			[]Commodities{{Name: "Gold", BuyPrice: 9150, Stock: 320, StockBracket: 2,
+				SellPrice: 9010}},
+		},
+		{
+			`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/2",` + header + `,` +
+				`"message":{"systemName":"Eranin","stationName":"Azeban City",` +
+				`"timestamp":"2015-06-01T12:00:00+00:00","commodities":[` +
+				`{"name":"Gold","buyPrice":9150,"supply":320,"supplyLevel":"Low","sellPrice":9010,"demand":0},` +
+				`{"name":"Tea","buyPrice":0,"supply":0,"sellPrice":1500,"demand":4000,"demandLevel":"High"}]}}`,
+			"2",
+			[]Commodities{
+				{Name: "Gold", BuyPrice: 9150, Stock: 320, StockBracket: 1, SellPrice: 9010},
+				{Name: "Tea", SellPrice: 1500, Demand: 4000, DemandBracket: 3},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		msg, err := ParseMessage([]byte(test.data))
+
+		if err != nil {
+			t.Fatalf("commodity/%s: %v", test.version, err)
+		}
+
+		commodity, ok := msg.(Commodity)
+
+		if !ok {
+			t.Fatalf("commodity/%s: got %T, want Commodity", test.version, msg)
+		}
+
+		if commodity.SourceVersion != test.version ||
+			commodity.SchemaRef != commodityV3URI {
+			t.Errorf("commodity/%s: upgraded to %s from version %q", test.version,
+				commodity.SchemaRef, commodity.SourceVersion)
+		}
+
+		if commodity.Message.SystemName != "Eranin" ||
+			commodity.Message.StationName != "Azeban City" ||
+			commodity.Header.SoftwareName != "EliteOCR" {
+			t.Errorf("commodity/%s: station or header lost: %+v", test.version, commodity)
+		}
+
+		if !reflect.DeepEqual(commodity.Message.Commodities, test.want) {
+			t.Errorf("commodity/%s: got %+v, want %+v", test.version,
+				commodity.Message.Commodities, test.want)
+		}
+	}
+}
+
+func benchmarkParseFeed(b *testing.B, wanted Filter) {
+	feed := loadFeed(b)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, data := range feed {
+			parseJSON(data, wanted, defaultRegistry, false, ValidationOff)
+		}
+	}
+}
+
+func BenchmarkParseFeed(b *testing.B) {
+	benchmarkParseFeed(b, nil)
+}
+
+func BenchmarkParseFeedJournalOnly(b *testing.B) {
+	benchmarkParseFeed(b, MaskFilter(journalOnly))
+}
+
+func TestParseLegacyOutfittingShipyard(t *testing.T) {
+	header := `"header":{"uploaderID":"cmdr","softwareName":"EDMC","softwareVersion":"1.0"}`
+	station := `"systemName":"Eranin","stationName":"Azeban City","timestamp":"2015-06-01T12:00:00+00:00"`
+
+	msg, err := ParseMessage([]byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/outfitting/1",` +
+		header + `,"message":{` + station + `,"modules":[` +
+		`{"category":"hardpoint","name":"Pulse Laser","mount":"Gimballed","class":"2","rating":"E"},` +
+		`{"category":"hardpoint","name":"Missile Rack","mount":"Fixed","guidance":"Seeker","class":"1","rating":"B"},` +
+		`{"category":"utility","name":"Shield Booster","class":"0","rating":"A"},` +
+		`{"category":"utility","name":"Chaff Launcher","class":"0","rating":"I"},` +
+		`{"category":"standard","name":"Thrusters","class":"3","rating":"A"},` +
+		`{"category":"standard","name":"Military Grade Composite","class":"1","rating":"I","ship":"Cobra Mk III"}]}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outfitting, ok := msg.(Outfitting)
+
+	if !ok {
+		t.Fatalf("got %T, want Outfitting", msg)
+	}
+
+	wantModules := []string{"Hpt_PulseLaser_Gimbal_Medium",
+		"Hpt_BasicMissileRack_Fixed_Small", "Hpt_ShieldBooster_Size0_Class5",
+		"Hpt_ChaffLauncher_Tiny", "Int_Engine_Size3_Class5",
+		"CobraMkIII_Armour_Grade3"}
+
+	if !reflect.DeepEqual(outfitting.Message.Modules, wantModules) {
+		t.Errorf("got modules %v, want %v", outfitting.Message.Modules, wantModules)
+	}
+
+	if outfitting.SourceVersion != "1" || outfitting.SchemaRef != outfittingV2URI ||
+		outfitting.Message.StationName != "Azeban City" {
+		t.Errorf("outfitting not upgraded: %+v", outfitting)
+	}
+
+	msg, err = ParseMessage([]byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/shipyard/1",` +
+		header + `,"message":{` + station + `,"ships":["Sidewinder",{"name":"Cobra Mk III"},"Imperial Clipper"]}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shipyard, ok := msg.(Shipyard)
+
+	if !ok {
+		t.Fatalf("got %T, want Shipyard", msg)
+	}
+
+	wantShips := []string{"SideWinder", "CobraMkIII", "Empire_Trader"}
+
+	if !reflect.DeepEqual(shipyard.Message.Ships, wantShips) {
+		t.Errorf("got ships %v, want %v", shipyard.Message.Ships, wantShips)
+	}
+
+	if shipyard.SourceVersion != "1" || shipyard.SchemaRef != shipyardV2URI {
+		t.Errorf("shipyard not upgraded: %+v", shipyard)
+	}
+}
+
+func TestParseJSONTestSchemas(t *testing.T) {
+	var tests int
+
+	for _, data := range loadFeed(t) {
+		msg, err := parseJSON(data, nil, defaultRegistry, true, ValidationOff)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if schemaRef, _ := messageEnvelope(msg); IsTestSchema(schemaRef) {
+			tests++
+		}
+	}
+
+	if tests != 1 {
+		t.Errorf("got %d test messages, want 1", tests)
+	}
+
+	// Legacy test messages stay marked as such once upgraded.
+	data := []byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/shipyard/1/test",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},` +
+		`"message":{"systemName":"Eranin","stationName":"Azeban City","ships":["Eagle"]}}`)
+
+	msg, err := decodeJSON(data, defaultRegistry, true, ValidationOff)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shipyard := msg.(Shipyard); shipyard.SchemaRef != shipyardV2URI+"/test" {
+		t.Errorf("upgraded test message has $schemaRef %s", shipyard.SchemaRef)
+	}
+
+	if _, err = decodeJSON(data, defaultRegistry, false, ValidationOff); !errors.Is(err, ErrTestSchema) {
+		t.Errorf("test message decoded without being asked for: %v", err)
+	}
+}
+
+func TestParseJSONValidation(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	envelope := `{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},`
+	commodities := `"timestamp":"2020-01-01T00:00:00Z","commodities":[{"name":"gold",` +
+		`"meanPrice":47609,"buyPrice":0,"stock":0,"stockBracket":0,"sellPrice":48000,` +
+		`"demand":12,"demandBracket":1}]}}`
+	valid := []byte(envelope + `"message":{"systemName":"Sol","stationName":"Abraham Lincoln",` +
+		commodities)
+	invalid := []byte(envelope + `"message":{"systemName":"Sol",` + commodities)
+
+	for _, mode := range []ValidationMode{ValidationDrop, ValidationFlag} {
+		if _, err := decodeJSON(valid, registry, false, mode); err != nil {
+			t.Errorf("valid message rejected: %v", err)
+		}
+	}
+
+	if _, err := decodeJSON(invalid, registry, false, ValidationOff); err != nil {
+		t.Errorf("message validated when not asked to be: %v", err)
+	}
+
+	msg, err := decodeJSON(invalid, registry, false, ValidationDrop)
+
+	var validationErr *ValidationError
+
+	if msg != nil || !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 {
+		t.Errorf("got %v, %v dropping invalid message", msg, err)
+	}
+
+	if msgErr, ok := err.(*MessageError); !ok || msgErr.Kind != ErrorValidation {
+		t.Errorf("got %#v, want a MessageError of kind ErrorValidation", err)
+	}
+
+	msg, err = decodeJSON(invalid, registry, false, ValidationFlag)
+
+	if _, ok := msg.(Commodity); !ok || !errors.As(err, &validationErr) {
+		t.Errorf("got %v, %v flagging invalid message", msg, err)
+	}
+}
+
+func TestParseJournalEvents(t *testing.T) {
+	stamp := Timestamp{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		message string
+		want    interface{}
+	}{
+		{`{"event":"Location","timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+			`"SystemAddress":10477373803,"StarPos":[0,0,0],"Docked":true,"StationName":"Abraham Lincoln",` +
+			`"MarketID":128016640,"Population":22780919531,` +
+			`"Factions":[{"Name":"Mother Gaia","Influence":0.573573}]}`,
+			JournalLocation{StarSystem: "Sol", SystemAddress: 10477373803,
+				Timestamp: stamp, Event: "Location",
+				StarPos: Vec3{0, 0, 0}, Docked: true, StationName: "Abraham Lincoln",
+				MarketID: 128016640, Population: 22780919531,
+				Factions: []Faction{{Name: "Mother Gaia", Influence: 0.573573}}}},
+		{`{"event":"CarrierJump","timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+			`"StarPos":[0,0,0],"Docked":true,"StationName":"K7Q-BQL","StationType":"FleetCarrier"}`,
+			JournalCarrierJump{StarSystem: "Sol", Timestamp: stamp,
+				Event: "CarrierJump", StarPos: Vec3{0, 0, 0}, Docked: true,
+				StationName: "K7Q-BQL", StationType: "FleetCarrier"}},
+		{`{"event":"SAASignalsFound","timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+			`"StarPos":[0,0,0],"BodyName":"Earth","BodyID":3,` +
+			`"Signals":[{"Type":"$SAA_SignalType_Biological;","Count":7}]}`,
+			JournalSAASignalsFound{StarSystem: "Sol", Timestamp: stamp,
+				Event: "SAASignalsFound", StarPos: Vec3{0, 0, 0}, BodyName: "Earth",
+				BodyID: 3, Signals: []Signal{{Type: "$SAA_SignalType_Biological;", Count: 7}}}},
+		{`{"event":"CodexEntry","timestamp":"2020-01-01T00:00:00Z","System":"Sol",` +
+			`"StarPos":[0,0,0],"EntryID":2100301,"Name":"$Codex_Ent_Standard_Water_Worlds_Name;",` +
+			`"Region":"$Codex_RegionName_18;","Category":"$Codex_Category_StellarBodies;",` +
+			`"SubCategory":"$Codex_SubCategory_Terrestrials;"}`,
+			JournalCodexEntry{System: "Sol", Timestamp: stamp,
+				Event: "CodexEntry", StarPos: Vec3{0, 0, 0}, EntryID: 2100301,
+				Name: "$Codex_Ent_Standard_Water_Worlds_Name;", Region: "$Codex_RegionName_18;",
+				Category:    "$Codex_Category_StellarBodies;",
+				SubCategory: "$Codex_SubCategory_Terrestrials;"}},
+		{`{"event":"NavBeaconScan","timestamp":"2020-01-01T00:00:00Z","NumBodies":12,` +
+			`"SystemAddress":9007199254740993}`,
+			JournalUnknown{"NavBeaconScan", map[string]interface{}{
+				"event": "NavBeaconScan", "timestamp": "2020-01-01T00:00:00Z",
+				"NumBodies": json.Number("12"), "SystemAddress": json.Number("9007199254740993")}}},
+	}
+
+	// The relay publishes journal messages under both the original schema
+	// URI, and that at eddn.edcd.io.
+	for _, schemaRef := range []string{"http://schemas.elite-markets.net/eddn/journal/1",
+		"https://eddn.edcd.io/schemas/journal/1"} {
+
+		for _, test := range tests {
+			msg, err := ParseMessage([]byte(`{"$schemaRef":"` + schemaRef + `",` +
+				`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},` +
+				`"message":` + test.message + `}`))
+
+			if err != nil {
+				t.Errorf("%s: %v", test.message, err)
+				continue
+			}
+
+			journal := msg.(Journal)
+
+			if got := withoutMissing(journal.Message); journal.SchemaRef != schemaRef ||
+				!reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s: got %#v, want %#v", schemaRef, got, test.want)
+			}
+		}
+	}
+}
+
+func TestParseJSONValidationJournal(t *testing.T) {
+	envelope := `{"$schemaRef":"https://eddn.edcd.io/schemas/journal/1",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},` +
+		`"message":{"timestamp":"2020-01-01T00:00:00Z","StarSystem":"Sol",` +
+		`"SystemAddress":10477373803,"StarPos":[0,0,0],`
+
+	// Every journal event the gateway accepts passes, including those the
+	// bundled schema doesn't list...
+	for _, test := range []struct {
+		message string
+		want    interface{}
+	}{
+		{`"event":"CarrierJump","Docked":true,"StationName":"K7Q-BQL"}}`, JournalCarrierJump{}},
+		{`"event":"NavBeaconScan","NumBodies":12}}`, JournalUnknown{}},
+	} {
+		msg, err := decodeJSON([]byte(envelope+test.message), defaultRegistry,
+			false, ValidationDrop)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.message, err)
+			continue
+		}
+
+		if got := msg.(Journal).Message; reflect.TypeOf(got) != reflect.TypeOf(test.want) {
+			t.Errorf("%s: got %T", test.message, got)
+		}
+	}
+
+	// ...but the rest of the schema still applies to them.
+	invalid := strings.Replace(envelope, `"StarSystem":"Sol",`, "", 1) +
+		`"event":"NavBeaconScan","NumBodies":12}}`
+
+	if _, err := decodeJSON([]byte(invalid), defaultRegistry, false,
+		ValidationDrop); err == nil {
+		t.Error("journal event without a StarSystem passed validation")
+	}
+}
+
+// BenchmarkDecodeJournal decodes the recorded journal sample in testdata,
+// which has one message for each journal event with a type of its own.
+func BenchmarkDecodeJournal(b *testing.B) {
+	data, err := ioutil.ReadFile("testdata/journal.jsonl")
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if _, err := decodeJournal(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
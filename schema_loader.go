@@ -0,0 +1,69 @@
+package EDDNClient
+
+import (
+	"embed"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// bundledSchemas holds the copies of the EDDN JSON Schemas in the schemas
+// directory, so that validation works without fetching them.
+//
+//go:embed schemas/*.json
+var bundledSchemas embed.FS
+
+// A SchemaLoader loads the JSON Schema named by the Document of a
+// SchemaDefinition, for validation.
+type SchemaLoader func(document string) (loader gojsonschema.JSONLoader, err error)
+
+// isURI reports whether document is a URI, rather than the name of a file
+// such as "commodity-v3.0.json".
+func isURI(document string) bool {
+	return strings.Contains(document, "://")
+}
+
+// BundledSchemas is the SchemaLoader used by default.  Documents named by
+// file, such as "commodity-v3.0.json", are read from the copies of the EDDN
+// schemas compiled into this package; documents named by URI are fetched
+// from it.
+func BundledSchemas(document string) (loader gojsonschema.JSONLoader, err error) {
+	if isURI(document) {
+		return gojsonschema.NewReferenceLoader(document), nil
+	}
+
+	data, err := bundledSchemas.ReadFile(path.Join("schemas", document))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gojsonschema.NewBytesLoader(data), nil
+}
+
+// SchemaDirectory returns a SchemaLoader that reads documents named by file
+// from dir, such as a checkout of the EDDN repository's schemas directory
+// holding newer versions of them.  Documents not found there are loaded by
+// BundledSchemas.
+func SchemaDirectory(dir string) SchemaLoader {
+	return func(document string) (loader gojsonschema.JSONLoader, err error) {
+		if isURI(document) {
+			return BundledSchemas(document)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(document)))
+
+		if os.IsNotExist(err) {
+			return BundledSchemas(document)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return gojsonschema.NewBytesLoader(data), nil
+	}
+}
@@ -0,0 +1,434 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xeipuuv/gojsonschema"
+	"reflect"
+	"sync"
+)
+
+// SchemaDefinition describes a single EDDN schema: how messages using it
+// are decoded when received, and encoded and validated when uploaded.
+//
+// Type should be a struct with SchemaRef, Header, and Message fields in the
+// manner of Commodity, as the default Decode and Encode rely on these.
+type SchemaDefinition struct {
+	URI          string         // The $schemaRef, such as "http://schemas.elite-markets.net/eddn/commodity/3"
+	TestURI      string         // The $schemaRef of the test variant, if there is one
+	Aliases      []string       // Other $schemaRefs the schema is published as, each with a "/test" variant if TestURI is set
+	Family       string         // Schema family, such as "commodity".  Defaults to that in URI.
+	Version      string         // Schema version, such as "3".  Defaults to that in URI.
+	Type         reflect.Type   // Type of the whole message, such as Commodity
+	MessageTypes []reflect.Type // Message bodies accepted by Uploader.Send, such as CommodityMessage
+	Document     string         // JSON Schema used for validation, if any: a file name, or URI, for the SchemaLoader
+
+	// Decode decodes an uncompressed message.  If nil the message is
+	// unmarshalled into a new value of Type.
+	Decode func(data []byte) (msg interface{}, err error)
+
+	// Encode wraps the message body msg, for upload, in a message using
+	// schemaRef and header.  If nil a new value of Type is filled in.
+	Encode func(schemaRef string, header Header, msg interface{}) (data interface{}, err error)
+}
+
+// schemaEntry is a registered SchemaDefinition, as found by $schemaRef.
+type schemaEntry struct {
+	def  *SchemaDefinition
+	test bool // Whether the entry is for def.TestURI, or the test variant of an alias
+}
+
+// A SchemaRegistry holds every schema a subscriber can decode, and an
+// Uploader can send.  NewSchemaRegistry returns a registry holding the
+// built in schemas, to which an application may Register schemas of its
+// own.  A SchemaRegistry is safe for concurrent use.
+//
+// The JSON Schemas used for validation are loaded by BundledSchemas unless
+// SetLoader is called.
+type SchemaRegistry struct {
+	mu         sync.RWMutex
+	byURI      map[string]schemaEntry
+	byType     map[reflect.Type]*SchemaDefinition
+	loader     SchemaLoader
+	validators map[*SchemaDefinition]*gojsonschema.Schema
+	generation int // Incremented by SetLoader, so older loads are discarded
+}
+
+// defaultRegistry is used wherever a SchemaRegistry isn't provided.
+var defaultRegistry = NewSchemaRegistry()
+
+// newEmptySchemaRegistry returns a registry without any schemas.
+func newEmptySchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		byURI:      make(map[string]schemaEntry),
+		byType:     make(map[reflect.Type]*SchemaDefinition),
+		loader:     BundledSchemas,
+		validators: make(map[*SchemaDefinition]*gojsonschema.Schema),
+	}
+}
+
+// NewSchemaRegistry returns a registry holding the schemas built in to this
+// package.
+func NewSchemaRegistry() *SchemaRegistry {
+	registry := newEmptySchemaRegistry()
+
+	for _, def := range builtinSchemas() {
+		if err := registry.Register(def); err != nil {
+			panic(err)
+		}
+	}
+
+	return registry
+}
+
+// builtinSchemas returns the definitions of the schemas built in to this
+// package.
+func builtinSchemas() []SchemaDefinition {
+	return []SchemaDefinition{
+		{
+			URI:          "http://schemas.elite-markets.net/eddn/blackmarket/1",
+			TestURI:      "http://schemas.elite-markets.net/eddn/blackmarket/1/test",
+			Aliases:      []string{"https://eddn.edcd.io/schemas/blackmarket/1"},
+			Type:         reflect.TypeOf(Blackmarket{}),
+			MessageTypes: []reflect.Type{reflect.TypeOf(BlackmarketMessage{})},
+			Document:     "blackmarket-v1.0.json",
+		},
+		{
+			URI:     "http://schemas.elite-markets.net/eddn/commodity/1",
+			TestURI: "http://schemas.elite-markets.net/eddn/commodity/1/test",
+			Type:    reflect.TypeOf(CommodityV1{}),
+			Decode:  decodeCommodityV1,
+		},
+		{
+			URI:     "http://schemas.elite-markets.net/eddn/commodity/2",
+			TestURI: "http://schemas.elite-markets.net/eddn/commodity/2/test",
+			Type:    reflect.TypeOf(CommodityV2{}),
+			Decode:  decodeCommodityV2,
+		},
+		{
+			URI:          commodityV3URI,
+			TestURI:      "http://schemas.elite-markets.net/eddn/commodity/3/test",
+			Aliases:      []string{"https://eddn.edcd.io/schemas/commodity/3"},
+			Type:         reflect.TypeOf(Commodity{}),
+			MessageTypes: []reflect.Type{reflect.TypeOf(CommodityMessage{})},
+			Document:     "commodity-v3.0.json",
+		},
+		{
+			URI:     "http://schemas.elite-markets.net/eddn/journal/1",
+			TestURI: "http://schemas.elite-markets.net/eddn/journal/1/test",
+			Aliases: []string{"https://eddn.edcd.io/schemas/journal/1"},
+			Type:    reflect.TypeOf(Journal{}),
+			MessageTypes: []reflect.Type{
+				reflect.TypeOf(JournalDocked{}),
+				reflect.TypeOf(JournalFSDJump{}),
+				reflect.TypeOf(JournalScanStar{}),
+				reflect.TypeOf(JournalScanPlanet{}),
+				reflect.TypeOf(JournalLocation{}),
+				reflect.TypeOf(JournalCarrierJump{}),
+				reflect.TypeOf(JournalSAASignalsFound{}),
+				reflect.TypeOf(JournalCodexEntry{}),
+			},
+			Document: "journal-v1.0.json",
+			Decode:   decodeJournal,
+		},
+		{
+			URI:     "http://schemas.elite-markets.net/eddn/outfitting/1",
+			TestURI: "http://schemas.elite-markets.net/eddn/outfitting/1/test",
+			Type:    reflect.TypeOf(OutfittingV1{}),
+			Decode:  decodeOutfittingV1,
+		},
+		{
+			URI:          outfittingV2URI,
+			TestURI:      "http://schemas.elite-markets.net/eddn/outfitting/2/test",
+			Aliases:      []string{"https://eddn.edcd.io/schemas/outfitting/2"},
+			Type:         reflect.TypeOf(Outfitting{}),
+			MessageTypes: []reflect.Type{reflect.TypeOf(OutfittingMessage{})},
+			Document:     "outfitting-v2.0.json",
+		},
+		{
+			URI:     "http://schemas.elite-markets.net/eddn/shipyard/1",
+			TestURI: "http://schemas.elite-markets.net/eddn/shipyard/1/test",
+			Type:    reflect.TypeOf(ShipyardV1{}),
+			Decode:  decodeShipyardV1,
+		},
+		{
+			URI:          shipyardV2URI,
+			TestURI:      "http://schemas.elite-markets.net/eddn/shipyard/2/test",
+			Aliases:      []string{"https://eddn.edcd.io/schemas/shipyard/2"},
+			Type:         reflect.TypeOf(Shipyard{}),
+			MessageTypes: []reflect.Type{reflect.TypeOf(ShipyardMessage{})},
+			Document:     "shipyard-v2.0.json",
+		},
+	}
+}
+
+// Register adds def to the registry, replacing any schema already
+// registered with the same URI, or accepting the same message types.  A
+// schema replaced by URI is removed entirely, along with its TestURI and
+// Aliases.
+func (registry *SchemaRegistry) Register(def SchemaDefinition) error {
+	if def.URI == "" {
+		return errors.New("schema definition has no URI")
+	}
+
+	if def.Type == nil && def.Decode == nil {
+		return fmt.Errorf("schema %s has neither a Type nor a Decode", def.URI)
+	}
+
+	family, version, _ := parseSchemaRef(def.URI)
+
+	if def.Family == "" {
+		def.Family = family
+	}
+
+	if def.Version == "" {
+		def.Version = version
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if entry, ok := registry.byURI[def.URI]; ok {
+		registry.remove(entry.def)
+	}
+
+	registry.byURI[def.URI] = schemaEntry{&def, false}
+
+	if def.TestURI != "" {
+		registry.byURI[def.TestURI] = schemaEntry{&def, true}
+	}
+
+	for _, alias := range def.Aliases {
+		registry.byURI[alias] = schemaEntry{&def, false}
+
+		if def.TestURI != "" {
+			registry.byURI[alias+"/test"] = schemaEntry{&def, true}
+		}
+	}
+
+	for _, messageType := range def.MessageTypes {
+		registry.byType[messageType] = &def
+	}
+
+	return nil
+}
+
+// remove removes every entry for def.  registry.mu must be held.
+func (registry *SchemaRegistry) remove(def *SchemaDefinition) {
+	for uri, entry := range registry.byURI {
+		if entry.def == def {
+			delete(registry.byURI, uri)
+		}
+	}
+
+	for messageType, typeDef := range registry.byType {
+		if typeDef == def {
+			delete(registry.byType, messageType)
+		}
+	}
+
+	delete(registry.validators, def)
+}
+
+// Lookup returns the schema registered for schemaRef, and whether
+// schemaRef is the test variant of it.
+func (registry *SchemaRegistry) Lookup(schemaRef string) (def *SchemaDefinition, test bool, ok bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	entry, ok := registry.byURI[schemaRef]
+
+	return entry.def, entry.test, ok
+}
+
+// LookupMessage returns the schema used to upload the message body msg,
+// which may be a value or a pointer.
+func (registry *SchemaRegistry) LookupMessage(msg interface{}) (def *SchemaDefinition, ok bool) {
+	messageType := reflect.TypeOf(msg)
+
+	if messageType != nil && messageType.Kind() == reflect.Ptr {
+		messageType = messageType.Elem()
+	}
+
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	def, ok = registry.byType[messageType]
+
+	return def, ok
+}
+
+// Schemas returns every schema in the registry.
+func (registry *SchemaRegistry) Schemas() (defs []*SchemaDefinition) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for uri, entry := range registry.byURI {
+		if uri == entry.def.URI {
+			defs = append(defs, entry.def)
+		}
+	}
+
+	return defs
+}
+
+// SetLoader replaces the SchemaLoader used to load JSON Schemas, such as
+// with SchemaDirectory to use newer versions than those bundled.  Schemas
+// already loaded are discarded.
+func (registry *SchemaRegistry) SetLoader(loader SchemaLoader) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.loader = loader
+	registry.validators = make(map[*SchemaDefinition]*gojsonschema.Schema)
+	registry.generation++
+}
+
+// validator returns the compiled JSON Schema for def, loading it the first
+// time it's needed.  Schemas without a Document have no validator.
+//
+// Loading may fetch the schema over the network, so is done without
+// holding registry.mu.  Should two loads race the first to finish is kept.
+func (registry *SchemaRegistry) validator(def *SchemaDefinition) (schema *gojsonschema.Schema, err error) {
+	if def.Document == "" {
+		return nil, nil
+	}
+
+	registry.mu.RLock()
+	schema, ok := registry.validators[def]
+	load, generation := registry.loader, registry.generation
+	registry.mu.RUnlock()
+
+	if ok {
+		return schema, nil
+	}
+
+	loader, err := load(def.Document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err = gojsonschema.NewSchema(loader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	// A schema loaded with a loader since replaced, or for a definition
+	// since replaced, is used this once but not kept.
+	if entry := registry.byURI[def.URI]; entry.def != def ||
+		registry.generation != generation {
+		return schema, nil
+	}
+
+	if loaded, ok := registry.validators[def]; ok {
+		return loaded, nil
+	}
+
+	registry.validators[def] = schema
+
+	return schema, nil
+}
+
+// validate checks the uncompressed message data against the JSON Schema of
+// def, returning a *ValidationError if it doesn't match.
+func (registry *SchemaRegistry) validate(def *SchemaDefinition, data []byte) (err error) {
+	return registry.validateExcept(def, data, nil)
+}
+
+// validateReceived is validate for a message received from the relay, which
+// the gateway has already checked against its own copy of the schema.  That
+// may list journal events the bundled copy doesn't yet, so failing only for
+// the event isn't held against the message.
+func (registry *SchemaRegistry) validateReceived(def *SchemaDefinition,
+	data []byte) (err error) {
+
+	return registry.validateExcept(def, data,
+		func(failure gojsonschema.ResultError) bool {
+			return failure.Field() == "message.event" && failure.Type() == "enum"
+		})
+}
+
+// validateExcept is validate, disregarding any failure for which ignore
+// returns true.
+func (registry *SchemaRegistry) validateExcept(def *SchemaDefinition, data []byte,
+	ignore func(failure gojsonschema.ResultError) bool) (err error) {
+
+	schema, err := registry.validator(def)
+
+	if err != nil || schema == nil {
+		return err
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+
+	for _, failure := range result.Errors() {
+		if ignore == nil || !ignore(failure) {
+			failures = append(failures, failure.String())
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return &ValidationError{failures}
+}
+
+// decode decodes an uncompressed message using def.
+func (def *SchemaDefinition) decode(data []byte) (msg interface{}, err error) {
+	if def.Decode != nil {
+		return def.Decode(data)
+	}
+
+	value := reflect.New(def.Type)
+
+	if err = json.Unmarshal(data, value.Interface()); decodeFailed(err) {
+		return nil, err
+	}
+
+	return value.Elem().Interface(), err
+}
+
+// encode wraps msg in a message of def's Type for upload.
+func (def *SchemaDefinition) encode(schemaRef string, header Header,
+	msg interface{}) (data interface{}, err error) {
+
+	if def.Encode != nil {
+		return def.Encode(schemaRef, header, msg)
+	}
+
+	body := reflect.ValueOf(msg)
+
+	if body.Kind() == reflect.Ptr {
+		body = body.Elem()
+	}
+
+	value := reflect.New(def.Type).Elem()
+	schemaField := value.FieldByName("SchemaRef")
+	headerField := value.FieldByName("Header")
+	messageField := value.FieldByName("Message")
+
+	if schemaField.Kind() != reflect.String || !headerField.IsValid() ||
+		headerField.Type() != reflect.TypeOf(header) ||
+		!messageField.IsValid() || !body.Type().AssignableTo(messageField.Type()) {
+		return nil, fmt.Errorf("can't encode %v as %s", body.Type(), def.URI)
+	}
+
+	schemaField.SetString(schemaRef)
+	headerField.Set(reflect.ValueOf(header))
+	messageField.Set(body)
+
+	return value.Addr().Interface(), nil
+}
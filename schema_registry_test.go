@@ -0,0 +1,248 @@
+package EDDNClient
+
+import (
+	"errors"
+	"github.com/xeipuuv/gojsonschema"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fleetCarrierMessage struct {
+	CarrierID string `json:"carrierID"`
+	Timestamp string `json:"timestamp"`
+}
+
+type fleetCarrier struct {
+	SchemaRef string              `json:"$schemaRef"`
+	Header    Header              `json:"header"`
+	Message   fleetCarrierMessage `json:"message"`
+}
+
+const fleetCarrierURI = "https://eddn.example.org/schemas/fleetcarrier/1"
+
+func TestSchemaRegistryCustomSchema(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	err := registry.Register(SchemaDefinition{
+		URI:          fleetCarrierURI,
+		TestURI:      fleetCarrierURI + "/test",
+		Type:         reflect.TypeOf(fleetCarrier{}),
+		MessageTypes: []reflect.Type{reflect.TypeOf(fleetCarrierMessage{})},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, test, ok := registry.Lookup(fleetCarrierURI)
+
+	if !ok || test || def.Family != "fleetcarrier" || def.Version != "1" {
+		t.Fatalf("Lookup returned %+v, %v, %v", def, test, ok)
+	}
+
+	data := []byte(`{"$schemaRef": "` + fleetCarrierURI + `",
+		"header": {"uploaderID": "cmdr", "softwareName": "test"},
+		"message": {"carrierID": "K7Q-BQL", "timestamp": "2017-01-01T00:00:00Z"}}`)
+
+	msg, err := registry.ParseMessage(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	carrier, ok := msg.(fleetCarrier)
+
+	if !ok || carrier.Message.CarrierID != "K7Q-BQL" {
+		t.Fatalf("ParseMessage returned %#v", msg)
+	}
+
+	if schemaRef, header := messageEnvelope(carrier); schemaRef != fleetCarrierURI ||
+		header.UploaderID != "cmdr" {
+		t.Errorf("messageEnvelope returned %q, %+v", schemaRef, header)
+	}
+
+	// The default registry is unaffected.
+	if _, err = ParseMessage(data); !errors.Is(err, errUnhandledSchema) {
+		t.Errorf("default registry decoded a custom schema: %v", err)
+	}
+
+	def, ok = registry.LookupMessage(&carrier.Message)
+
+	if !ok {
+		t.Fatal("LookupMessage found no schema")
+	}
+
+	encoded, err := def.encode(def.URI, carrier.Header, &carrier.Message)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(encoded, &carrier) {
+		t.Errorf("encode returned %#v, want %#v", encoded, &carrier)
+	}
+}
+
+func TestSchemaRegistryBuiltins(t *testing.T) {
+	for _, msg := range []interface{}{&BlackmarketMessage{},
+		&CommodityMessage{}, &JournalFSDJump{}, &OutfittingMessage{},
+		&ShipyardMessage{}} {
+
+		def, ok := defaultRegistry.LookupMessage(msg)
+
+		if !ok {
+			t.Errorf("no schema for %T", msg)
+			continue
+		}
+
+		if _, err := def.encode(def.URI, Header{}, msg); err != nil {
+			t.Errorf("encoding %T: %v", msg, err)
+		}
+	}
+}
+
+func TestSchemaLoaders(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	// Every built in schema is bundled, so loads without the network.
+	for _, def := range registry.Schemas() {
+		if _, err := registry.validator(def); err != nil {
+			t.Errorf("%s: %v", def.URI, err)
+		}
+	}
+
+	def, _, _ := registry.Lookup(commodityV3URI)
+	data := []byte(`{"$schemaRef":"http://schemas.elite-markets.net/eddn/commodity/3",` +
+		`"header":{"uploaderID":"cmdr","softwareName":"test","softwareVersion":"1"},` +
+		`"message":{"systemName":"Sol","stationName":"Abraham Lincoln",` +
+		`"timestamp":"2020-01-01T00:00:00Z","commodities":[{"name":"gold",` +
+		`"meanPrice":47609,"buyPrice":0,"stock":0,"stockBracket":0,"sellPrice":48000,` +
+		`"demand":12,"demandBracket":1}]}}`)
+
+	if err := registry.validate(def, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// A newer commodity schema in a directory overrides the bundled one,
+	// while the others are still found.
+	dir, err := ioutil.TempDir("", "eddn-schemas-")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	newer := []byte(`{"$schema":"http://json-schema.org/draft-04/schema#",` +
+		`"type":"object","required":["message"],"properties":{"message":{` +
+		`"type":"object","required":["marketId"]}}}`)
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "commodity-v3.0.json"), newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry.SetLoader(SchemaDirectory(dir))
+
+	var validationErr *ValidationError
+
+	if err = registry.validate(def, data); !errors.As(err, &validationErr) {
+		t.Errorf("got %v validating against the newer schema", err)
+	}
+
+	for _, def := range registry.Schemas() {
+		if _, err := registry.validator(def); err != nil {
+			t.Errorf("%s: %v", def.URI, err)
+		}
+	}
+
+	// As does a custom loader.
+	registry.SetLoader(func(document string) (gojsonschema.JSONLoader, error) {
+		return gojsonschema.NewBytesLoader(newer), nil
+	})
+
+	if err = registry.validate(def, data); !errors.As(err, &validationErr) {
+		t.Errorf("got %v validating with a custom loader", err)
+	}
+}
+
+func TestSchemaRegistryReplace(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	def := SchemaDefinition{
+		URI:          fleetCarrierURI,
+		TestURI:      fleetCarrierURI + "/test",
+		Type:         reflect.TypeOf(fleetCarrier{}),
+		MessageTypes: []reflect.Type{reflect.TypeOf(fleetCarrierMessage{})},
+	}
+
+	if err := registry.Register(def); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replacing the schema leaves nothing of the old one behind.
+	def.TestURI = ""
+	def.MessageTypes = nil
+
+	if err := registry.Register(def); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := registry.Lookup(fleetCarrierURI + "/test"); ok {
+		t.Error("the replaced schema's TestURI is still registered")
+	}
+
+	if _, ok := registry.LookupMessage(fleetCarrierMessage{}); ok {
+		t.Error("the replaced schema's message type is still registered")
+	}
+
+	if got, want := len(registry.Schemas()), len(builtinSchemas())+1; got != want {
+		t.Errorf("got %d schemas, want %d", got, want)
+	}
+}
+
+func TestSchemaRegistrySlowLoad(t *testing.T) {
+	registry := NewSchemaRegistry()
+	loading := make(chan struct{})
+	release := make(chan struct{})
+
+	registry.SetLoader(func(document string) (gojsonschema.JSONLoader, error) {
+		loading <- struct{}{}
+		<-release
+
+		return BundledSchemas(document)
+	})
+
+	def, _, _ := registry.Lookup(commodityV3URI)
+	loaded := make(chan error)
+
+	go func() {
+		_, err := registry.validator(def)
+		loaded <- err
+	}()
+
+	// The registry can be used while a schema loads.
+	<-loading
+
+	if _, _, ok := registry.Lookup(commodityV3URI); !ok {
+		t.Error("Lookup failed while a schema loaded")
+	}
+
+	if err := registry.Register(SchemaDefinition{URI: fleetCarrierURI,
+		Type: reflect.TypeOf(fleetCarrier{})}); err != nil {
+		t.Error(err)
+	}
+
+	close(release)
+
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema loaded is kept.
+	if _, err := registry.validator(def); err != nil {
+		t.Error(err)
+	}
+}
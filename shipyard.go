@@ -2,15 +2,20 @@ package EDDNClient
 
 // ShipyardMessage contains the shipyard data sent to EDDN.
 type ShipyardMessage struct {
-	Ships       []string `json:"ships"`       // Required
-	StationName string   `json:"stationName"` // Required
-	SystemName  string   `json:"systemName"`  // Required
-	Timestamp   string   `json:"timestamp"`   // Required
+	Ships       []string  `json:"ships"`       // Required
+	StationName string    `json:"stationName"` // Required
+	SystemName  string    `json:"systemName"`  // Required
+	Timestamp   Timestamp `json:"timestamp"`   // Required
+	Extras                // Fields not otherwise decoded, see Extras
 }
 
 // Shipyard is the high level type that contains the entire JSON message.
+// Messages received using the legacy shipyard/1 schema are upgraded to this
+// one, and record the version they were sent as in SourceVersion.
 type Shipyard struct {
-	SchemaRef string          `json:"$schemaRef"`
-	Header    Header          `json:"header"`
-	Message   ShipyardMessage `json:"message"`
+	SchemaRef     string          `json:"$schemaRef"`
+	Header        Header          `json:"header"`
+	Message       ShipyardMessage `json:"message"`
+	Extras                        // Fields not otherwise decoded, see Extras
+	SourceVersion string          `json:"-"` // Version upgraded from, if received as a legacy schema
 }
@@ -0,0 +1,137 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ShipyardV1Ship is a single ship in a ShipyardV1Message.  Uploaders of the
+// shipyard/1 schema sent either the ship's name alone, or an object holding
+// it, and both are accepted.
+type ShipyardV1Ship struct {
+	Name string `json:"name"` // Display name, such as "Cobra Mk III"
+}
+
+// UnmarshalJSON accepts either a string or an object with a name.
+func (ship *ShipyardV1Ship) UnmarshalJSON(data []byte) (err error) {
+	if err = json.Unmarshal(data, &ship.Name); err == nil {
+		return nil
+	}
+
+	var object struct {
+		Name string `json:"name"`
+	}
+
+	if err = json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	ship.Name = object.Name
+
+	return nil
+}
+
+// ShipyardV1Message is the message body of the shipyard/1 schema.
+type ShipyardV1Message struct {
+	Ships       []ShipyardV1Ship `json:"ships"`
+	StationName string           `json:"stationName"`
+	SystemName  string           `json:"systemName"`
+	Timestamp   Timestamp        `json:"timestamp"`
+	Extras                       // Fields not otherwise decoded, see Extras
+}
+
+// ShipyardV1 is a whole shipyard/1 message.
+type ShipyardV1 struct {
+	SchemaRef string            `json:"$schemaRef"`
+	Header    Header            `json:"header"`
+	Message   ShipyardV1Message `json:"message"`
+	Extras                      // Fields not otherwise decoded, see Extras
+}
+
+// shipyardV2URI is the $schemaRef of the current shipyard schema, which
+// legacy messages are upgraded to.
+const shipyardV2URI = "http://schemas.elite-markets.net/eddn/shipyard/2"
+
+// shipSymbols maps the display names of ships, as used by the legacy
+// schemas, to the names used by the current ones.
+var shipSymbols = map[string]string{
+	"Adder":                "Adder",
+	"Anaconda":             "Anaconda",
+	"Asp":                  "Asp",
+	"Asp Explorer":         "Asp",
+	"Asp Scout":            "Asp_Scout",
+	"Beluga Liner":         "BelugaLiner",
+	"Cobra Mk III":         "CobraMkIII",
+	"Cobra Mk IV":          "CobraMkIV",
+	"Diamondback Explorer": "DiamondBackXL",
+	"Diamondback Scout":    "DiamondBack",
+	"Eagle":                "Eagle",
+	"Federal Assault Ship": "Federation_Dropship_MkII",
+	"Federal Corvette":     "Federation_Corvette",
+	"Federal Dropship":     "Federation_Dropship",
+	"Federal Gunship":      "Federation_Gunship",
+	"Fer-de-Lance":         "FerDeLance",
+	"Hauler":               "Hauler",
+	"Imperial Clipper":     "Empire_Trader",
+	"Imperial Courier":     "Empire_Courier",
+	"Imperial Cutter":      "Cutter",
+	"Imperial Eagle":       "Empire_Eagle",
+	"Keelback":             "Independant_Trader",
+	"Orca":                 "Orca",
+	"Python":               "Python",
+	"Sidewinder":           "SideWinder",
+	"Type-6 Transporter":   "Type6",
+	"Type-7 Transporter":   "Type7",
+	"Type-9 Heavy":         "Type9",
+	"Viper":                "Viper",
+	"Viper Mk III":         "Viper",
+	"Viper Mk IV":          "Viper_MkIV",
+	"Vulture":              "Vulture",
+}
+
+// shipSymbol returns the current name of the ship with the given display
+// name.  Ships not known are named by their display name without spaces.
+func shipSymbol(name string) string {
+	if symbol, ok := shipSymbols[name]; ok {
+		return symbol
+	}
+
+	return strings.Replace(name, " ", "", -1)
+}
+
+// Upgrade converts msg to the current shipyard schema, translating the
+// display name of every ship to the name used by shipyard/2.  The message's
+// Extra fields are kept in those of the result.
+func (msg ShipyardV1) Upgrade() Shipyard {
+	ships := make([]string, len(msg.Message.Ships))
+
+	for i, ship := range msg.Message.Ships {
+		ships[i] = shipSymbol(ship.Name)
+	}
+
+	return Shipyard{
+		SchemaRef: shipyardV2URI,
+		Header:    msg.Header,
+		Extras:    Extras{Extra: msg.Extra},
+		Message: ShipyardMessage{
+			Ships:       ships,
+			StationName: msg.Message.StationName,
+			SystemName:  msg.Message.SystemName,
+			Timestamp:   msg.Message.Timestamp,
+			Extras:      Extras{Extra: msg.Message.Extra},
+		},
+		SourceVersion: "1",
+	}
+}
+
+// decodeShipyardV1 is the SchemaDefinition.Decode for shipyard/1, which
+// delivers the message upgraded to a Shipyard.
+func decodeShipyardV1(data []byte) (msg interface{}, err error) {
+	var legacy ShipyardV1
+
+	if err = decodeExtras(data, &legacy); decodeFailed(err) {
+		return nil, err
+	}
+
+	return legacy.Upgrade(), err
+}
@@ -0,0 +1,339 @@
+package EDDNClient
+
+import (
+	"context"
+	"sync"
+)
+
+// A Subscriber dispatches messages from EDDN to handlers registered on it,
+// rather than sending them on channels.  Journal messages may be handled by
+// event, and the typed journal handlers such as OnJournalFSDJump receive
+// the event itself so no type assertions are needed.
+//
+// Handlers must all be registered before Run is called.  They are called
+// from a pool of worker goroutines, one by default, so handlers for a
+// Subscriber with more than one worker must be safe for concurrent use and
+// will not necessarily see messages in the order they were received.
+//
+// With ChannelOptions.Validation set, messages failing validation are
+// passed to the error handlers, and are only dispatched to the message
+// handlers as well if it is ValidationFlag.
+type Subscriber struct {
+	filter  int            // Filter, as for NewChannelInterface
+	opts    ChannelOptions // Connection options
+	workers int            // Number of goroutines calling handlers
+
+	journal     []func(Journal)
+	events      map[string][]func(Journal)
+	fsdJump     []func(JournalFSDJump)
+	docked      []func(JournalDocked)
+	scanStar    []func(JournalScanStar)
+	scanPlanet  []func(JournalScanPlanet)
+	location    []func(JournalLocation)
+	carrierJump []func(JournalCarrierJump)
+	saaSignals  []func(JournalSAASignalsFound)
+	codexEntry  []func(JournalCodexEntry)
+	unknown     []func(JournalUnknown)
+	shipyard    []func(Shipyard)
+	commodity   []func(Commodity)
+	blackmarket []func(Blackmarket)
+	outfitting  []func(Outfitting)
+	errors      []func(error)
+	states      []func(ConnectionEvent)
+}
+
+// NewSubscriber creates a Subscriber using the provided filter and options,
+// which mean the same as they do for NewChannelInterfaceContext.  Nothing
+// is received until Run is called.
+func NewSubscriber(filter int, opts ChannelOptions) *Subscriber {
+	return &Subscriber{
+		filter:  filter,
+		opts:    opts,
+		workers: 1,
+		events:  make(map[string][]func(Journal)),
+	}
+}
+
+// SetWorkers sets the number of goroutines used to call message handlers.
+// Values less than one are treated as one.
+func (s *Subscriber) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	s.workers = workers
+}
+
+// OnJournal registers a handler for every journal message.
+func (s *Subscriber) OnJournal(handler func(Journal)) {
+	s.journal = append(s.journal, handler)
+}
+
+// OnJournalEvent registers a handler for journal messages whose event is
+// named event, such as "FSDJump" or "Scan".
+func (s *Subscriber) OnJournalEvent(event string, handler func(Journal)) {
+	s.events[event] = append(s.events[event], handler)
+}
+
+// OnJournalFSDJump registers a handler for FSDJump journal events.
+func (s *Subscriber) OnJournalFSDJump(handler func(JournalFSDJump)) {
+	s.fsdJump = append(s.fsdJump, handler)
+}
+
+// OnJournalDocked registers a handler for Docked journal events.
+func (s *Subscriber) OnJournalDocked(handler func(JournalDocked)) {
+	s.docked = append(s.docked, handler)
+}
+
+// OnJournalScanStar registers a handler for Scan journal events describing
+// a star.
+func (s *Subscriber) OnJournalScanStar(handler func(JournalScanStar)) {
+	s.scanStar = append(s.scanStar, handler)
+}
+
+// OnJournalScanPlanet registers a handler for Scan journal events
+// describing a planet, or moon.
+func (s *Subscriber) OnJournalScanPlanet(handler func(JournalScanPlanet)) {
+	s.scanPlanet = append(s.scanPlanet, handler)
+}
+
+// OnJournalLocation registers a handler for Location journal events.
+func (s *Subscriber) OnJournalLocation(handler func(JournalLocation)) {
+	s.location = append(s.location, handler)
+}
+
+// OnJournalCarrierJump registers a handler for CarrierJump journal events.
+func (s *Subscriber) OnJournalCarrierJump(handler func(JournalCarrierJump)) {
+	s.carrierJump = append(s.carrierJump, handler)
+}
+
+// OnJournalSAASignalsFound registers a handler for SAASignalsFound journal
+// events.
+func (s *Subscriber) OnJournalSAASignalsFound(handler func(JournalSAASignalsFound)) {
+	s.saaSignals = append(s.saaSignals, handler)
+}
+
+// OnJournalCodexEntry registers a handler for CodexEntry journal events.
+func (s *Subscriber) OnJournalCodexEntry(handler func(JournalCodexEntry)) {
+	s.codexEntry = append(s.codexEntry, handler)
+}
+
+// OnJournalUnknown registers a handler for journal events this package has
+// no type for.
+func (s *Subscriber) OnJournalUnknown(handler func(JournalUnknown)) {
+	s.unknown = append(s.unknown, handler)
+}
+
+// OnShipyard registers a handler for shipyard messages.
+func (s *Subscriber) OnShipyard(handler func(Shipyard)) {
+	s.shipyard = append(s.shipyard, handler)
+}
+
+// OnCommodity registers a handler for commodity messages.
+func (s *Subscriber) OnCommodity(handler func(Commodity)) {
+	s.commodity = append(s.commodity, handler)
+}
+
+// OnBlackmarket registers a handler for blackmarket messages.
+func (s *Subscriber) OnBlackmarket(handler func(Blackmarket)) {
+	s.blackmarket = append(s.blackmarket, handler)
+}
+
+// OnOutfitting registers a handler for outfitting messages.
+func (s *Subscriber) OnOutfitting(handler func(Outfitting)) {
+	s.outfitting = append(s.outfitting, handler)
+}
+
+// OnError registers a handler for receive and decode errors, as sent on a
+// ChannelInterface's Errors channel.  Error handlers are not called from
+// the worker pool, and should return quickly.
+func (s *Subscriber) OnError(handler func(error)) {
+	s.errors = append(s.errors, handler)
+}
+
+// OnStateChange registers a handler for changes in the connection to the
+// relay.  Like error handlers, these are not called from the worker pool.
+func (s *Subscriber) OnStateChange(handler func(ConnectionEvent)) {
+	s.states = append(s.states, handler)
+}
+
+// Run connects to EDDN and dispatches messages to the registered handlers
+// until ctx is cancelled.  Run returns once every handler that was called
+// has returned.  The only errors returned are those preventing the
+// Subscriber from starting.
+func (s *Subscriber) Run(ctx context.Context) (err error) {
+	stream, err := NewEventStream(ctx, s.filter, s.opts)
+
+	if err != nil {
+		return err
+	}
+
+	s.serve(stream)
+
+	return nil
+}
+
+// serve passes everything received from stream to the registered handlers,
+// messages by way of the worker pool, until every channel of stream has
+// been closed and the workers have finished.
+func (s *Subscriber) serve(stream *EventStream) {
+	jobs := make(chan Event)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for e := range jobs {
+				s.dispatch(e.Payload())
+			}
+		}()
+	}
+
+	events, errs, states := stream.Events, stream.Errors, stream.States
+
+	for events != nil || errs != nil || states != nil {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+
+			jobs <- e
+
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			for _, handler := range s.errors {
+				handler(err)
+			}
+
+		case state, ok := <-states:
+			if !ok {
+				states = nil
+				continue
+			}
+
+			for _, handler := range s.states {
+				handler(state)
+			}
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+// dispatch calls every handler registered for msg.
+func (s *Subscriber) dispatch(msg interface{}) {
+	switch msg := msg.(type) {
+	case Journal:
+		s.dispatchJournal(msg)
+
+	case Shipyard:
+		for _, handler := range s.shipyard {
+			handler(msg)
+		}
+
+	case Commodity:
+		for _, handler := range s.commodity {
+			handler(msg)
+		}
+
+	case Blackmarket:
+		for _, handler := range s.blackmarket {
+			handler(msg)
+		}
+
+	case Outfitting:
+		for _, handler := range s.outfitting {
+			handler(msg)
+		}
+	}
+}
+
+// dispatchJournal calls every generic, per event, and typed handler
+// registered for the journal message msg.
+func (s *Subscriber) dispatchJournal(msg Journal) {
+	for _, handler := range s.journal {
+		handler(msg)
+	}
+
+	var event string
+
+	switch journalMsg := msg.Message.(type) {
+	case JournalFSDJump:
+		event = journalMsg.Event
+
+		for _, handler := range s.fsdJump {
+			handler(journalMsg)
+		}
+
+	case JournalDocked:
+		event = journalMsg.Event
+
+		for _, handler := range s.docked {
+			handler(journalMsg)
+		}
+
+	case JournalScanStar:
+		event = journalMsg.Event
+
+		for _, handler := range s.scanStar {
+			handler(journalMsg)
+		}
+
+	case JournalScanPlanet:
+		event = journalMsg.Event
+
+		for _, handler := range s.scanPlanet {
+			handler(journalMsg)
+		}
+
+	case JournalLocation:
+		event = journalMsg.Event
+
+		for _, handler := range s.location {
+			handler(journalMsg)
+		}
+
+	case JournalCarrierJump:
+		event = journalMsg.Event
+
+		for _, handler := range s.carrierJump {
+			handler(journalMsg)
+		}
+
+	case JournalSAASignalsFound:
+		event = journalMsg.Event
+
+		for _, handler := range s.saaSignals {
+			handler(journalMsg)
+		}
+
+	case JournalCodexEntry:
+		event = journalMsg.Event
+
+		for _, handler := range s.codexEntry {
+			handler(journalMsg)
+		}
+
+	case JournalUnknown:
+		event = journalMsg.Event
+
+		for _, handler := range s.unknown {
+			handler(journalMsg)
+		}
+	}
+
+	for _, handler := range s.events[event] {
+		handler(msg)
+	}
+}
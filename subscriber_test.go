@@ -0,0 +1,195 @@
+package EDDNClient
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loadMessages decodes every message in the given testdata files, leaving
+// out those using the /test schemas.
+func loadMessages(t *testing.T, names ...string) (messages []interface{}) {
+	for _, name := range names {
+		file, err := os.Open("testdata/" + name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+
+		for scanner.Scan() {
+			msg, err := defaultRegistry.ParseMessage(scanner.Bytes())
+
+			if errors.Is(err, ErrTestSchema) {
+				continue
+			}
+
+			if err != nil {
+				file.Close()
+				t.Fatal(err)
+			}
+
+			messages = append(messages, msg)
+		}
+
+		file.Close()
+
+		if err = scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return messages
+}
+
+// handlerCounts registers a handler of every kind on s, returning the number
+// of times each is called, by name.
+func handlerCounts(s *Subscriber, events ...string) (counts map[string]int,
+	mu *sync.Mutex) {
+
+	counts = make(map[string]int)
+	mu = new(sync.Mutex)
+
+	count := func(name string) {
+		mu.Lock()
+		counts[name]++
+		mu.Unlock()
+	}
+
+	s.OnJournal(func(Journal) { count("journal") })
+	s.OnJournalFSDJump(func(JournalFSDJump) { count("FSDJump") })
+	s.OnJournalDocked(func(JournalDocked) { count("Docked") })
+	s.OnJournalScanStar(func(JournalScanStar) { count("ScanStar") })
+	s.OnJournalScanPlanet(func(JournalScanPlanet) { count("ScanPlanet") })
+	s.OnJournalLocation(func(JournalLocation) { count("Location") })
+	s.OnJournalCarrierJump(func(JournalCarrierJump) { count("CarrierJump") })
+	s.OnJournalSAASignalsFound(func(JournalSAASignalsFound) { count("SAASignalsFound") })
+	s.OnJournalCodexEntry(func(JournalCodexEntry) { count("CodexEntry") })
+	s.OnJournalUnknown(func(JournalUnknown) { count("unknown") })
+	s.OnShipyard(func(Shipyard) { count("shipyard") })
+	s.OnCommodity(func(Commodity) { count("commodity") })
+	s.OnBlackmarket(func(Blackmarket) { count("blackmarket") })
+	s.OnOutfitting(func(Outfitting) { count("outfitting") })
+
+	for _, event := range events {
+		event := event
+		s.OnJournalEvent(event, func(Journal) { count("event " + event) })
+	}
+
+	return counts, mu
+}
+
+// wantCounts is how often each handler registered by handlerCounts is
+// called for the messages returned by testMessages: once for every message
+// it applies to.
+var wantCounts = map[string]int{
+	"journal":         14,
+	"FSDJump":         3,
+	"Docked":          2,
+	"ScanStar":        2,
+	"ScanPlanet":      2,
+	"Location":        1,
+	"CarrierJump":     1,
+	"SAASignalsFound": 1,
+	"CodexEntry":      1,
+	"unknown":         1,
+	"shipyard":        1,
+	"commodity":       3,
+	"blackmarket":     1,
+	"outfitting":      1,
+	"event FSDJump":   3,
+	"event Scan":      4,
+	"event Touchdown": 1,
+}
+
+// testMessages returns the messages in testdata, with a journal event that
+// has no type of its own added.
+func testMessages(t *testing.T) (messages []interface{}) {
+	messages = loadMessages(t, "journal.jsonl", "feed.jsonl")
+
+	unknown, err := defaultRegistry.ParseMessage([]byte(`{
+		"$schemaRef": "http://schemas.elite-markets.net/eddn/journal/1",
+		"header": {"uploaderID": "cmdr", "softwareName": "test", "softwareVersion": "1.0"},
+		"message": {"timestamp": "2021-03-01T12:00:00Z", "event": "Touchdown",
+			"StarSystem": "Sol", "SystemAddress": 10477373803, "Latitude": 12.5}}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(messages, unknown)
+}
+
+func checkCounts(t *testing.T, counts map[string]int) {
+	for name, want := range wantCounts {
+		if counts[name] != want {
+			t.Errorf("%s handlers called %d times, want %d", name, counts[name], want)
+		}
+	}
+
+	if len(counts) != len(wantCounts) {
+		t.Errorf("handlers called %v, want %v", counts, wantCounts)
+	}
+}
+
+func TestSubscriberDispatch(t *testing.T) {
+	s := NewSubscriber(FilterNone, DefaultChannelOptions())
+	counts, _ := handlerCounts(s, "FSDJump", "Scan", "Touchdown")
+
+	for _, msg := range testMessages(t) {
+		s.dispatch(msg)
+	}
+
+	checkCounts(t, counts)
+}
+
+func TestSubscriberServe(t *testing.T) {
+	s := NewSubscriber(FilterNone, DefaultChannelOptions())
+	s.SetWorkers(4)
+
+	counts, mu := handlerCounts(s, "FSDJump", "Scan", "Touchdown")
+
+	var reported []string
+	var changes []ConnectionState
+
+	s.OnError(func(err error) { reported = append(reported, err.Error()) })
+	s.OnStateChange(func(event ConnectionEvent) { changes = append(changes, event.State) })
+
+	events := make(chan Event)
+	errs := make(chan error, 1)
+	states := make(chan ConnectionEvent, 1)
+
+	errs <- &MessageError{Kind: ErrorJSON, Err: os.ErrInvalid}
+	states <- ConnectionEvent{State: StateConnected}
+	close(errs)
+	close(states)
+
+	messages := testMessages(t)
+
+	go func() {
+		for _, msg := range messages {
+			events <- newEvent(delivery{msg, time.Now(), nil})
+		}
+
+		close(events)
+	}()
+
+	// serve only returns once every handler has.
+	s.serve(&EventStream{Events: events, Errors: errs, States: states})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkCounts(t, counts)
+
+	if len(reported) != 1 || !strings.Contains(reported[0], os.ErrInvalid.Error()) ||
+		len(changes) != 1 || changes[0] != StateConnected {
+		t.Errorf("got errors %v, states %v", reported, changes)
+	}
+}
@@ -0,0 +1,93 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Timestamp is a time sent in a message.  It marshals to the RFC 3339 form
+// the schemas require, and unmarshals leniently, as uploaders don't always
+// send exactly that.  A zero Timestamp marshals as null.  Anything
+// ParseTimestamp can't make sense of unmarshals as a zero Timestamp rather
+// than failing the whole message; see Extras for where it is kept.
+type Timestamp struct {
+	time.Time
+}
+
+// timestampLayouts are the formats of timestamps seen on the wire, tried in
+// order.  Those without a zone are taken to be UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ParseTimestamp parses value, which may be in any of the formats seen on
+// the wire, such as "2017-03-22T12:34:56Z", "2017-03-22T12:34:56.123+01:00"
+// or, without a zone, "2017-03-22 12:34:56".
+func ParseTimestamp(value string) (timestamp Timestamp, err error) {
+	if value == "" {
+		return timestamp, nil
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Timestamp{t}, nil
+		}
+	}
+
+	return timestamp, fmt.Errorf("unrecognised timestamp %q", value)
+}
+
+// String returns the timestamp as it is marshalled.
+func (timestamp Timestamp) String() string {
+	if timestamp.IsZero() {
+		return ""
+	}
+
+	return timestamp.Format(time.RFC3339Nano)
+}
+
+// MarshalJSON encodes the timestamp in RFC 3339 form, or as null if it is
+// zero.
+func (timestamp Timestamp) MarshalJSON() ([]byte, error) {
+	if timestamp.IsZero() {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(timestamp.String())
+}
+
+// UnmarshalJSON decodes a timestamp in any of the formats ParseTimestamp
+// accepts, leaving the timestamp zero if data is in none of them.
+func (timestamp *Timestamp) UnmarshalJSON(data []byte) (err error) {
+	*timestamp, _ = decodeTimestamp(data)
+
+	return nil
+}
+
+// decodeError returns the error decoding data as a timestamp, if any.
+func (Timestamp) decodeError(data []byte) error {
+	_, err := decodeTimestamp(data)
+
+	return err
+}
+
+// decodeTimestamp decodes data, which is null or a string ParseTimestamp
+// accepts.
+func decodeTimestamp(data []byte) (timestamp Timestamp, err error) {
+	var value *string
+
+	if err = json.Unmarshal(data, &value); err != nil {
+		return timestamp, err
+	}
+
+	if value == nil {
+		return timestamp, nil
+	}
+
+	return ParseTimestamp(*value)
+}
@@ -0,0 +1,87 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampFormats(t *testing.T) {
+	want := time.Date(2017, 3, 22, 12, 34, 56, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+		out   string
+	}{
+		{`"2017-03-22T12:34:56Z"`, want, `"2017-03-22T12:34:56Z"`},
+		{`"2017-03-22T12:34:56.25Z"`, want.Add(250 * time.Millisecond), `"2017-03-22T12:34:56.25Z"`},
+		{`"2017-03-22T13:34:56+01:00"`, want, `"2017-03-22T13:34:56+01:00"`},
+		{`"2017-03-22T13:34:56+0100"`, want, `"2017-03-22T13:34:56+01:00"`},
+		{`"2017-03-22T12:34:56"`, want, `"2017-03-22T12:34:56Z"`},
+		{`"2017-03-22 12:34:56"`, want, `"2017-03-22T12:34:56Z"`},
+		{`""`, time.Time{}, `null`},
+		{`null`, time.Time{}, `null`},
+	}
+
+	for _, test := range tests {
+		var timestamp Timestamp
+
+		if err := json.Unmarshal([]byte(test.value), &timestamp); err != nil {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+
+		if !timestamp.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.value, timestamp.Time, test.want)
+		}
+
+		if out, _ := json.Marshal(timestamp); string(out) != test.out {
+			t.Errorf("%s: marshalled as %s, want %s", test.value, out, test.out)
+		}
+	}
+
+	// Unrecognised timestamps are left zero, with the reason kept aside.
+	timestamp := Timestamp{want}
+
+	if err := json.Unmarshal([]byte(`"22/03/2017"`), &timestamp); err != nil ||
+		!timestamp.IsZero() {
+		t.Errorf("unrecognised timestamp gave %v, %v", timestamp.Time, err)
+	}
+
+	if timestamp.decodeError([]byte(`"22/03/2017"`)) == nil {
+		t.Error("unrecognised timestamp accepted")
+	}
+}
+
+func TestVec3(t *testing.T) {
+	var pos Vec3
+
+	if err := json.Unmarshal([]byte(`[3, 4, 12]`), &pos); err != nil {
+		t.Fatal(err)
+	}
+
+	if distance := pos.Distance(Vec3{}); distance != 13 {
+		t.Errorf("got distance %v, want 13", distance)
+	}
+
+	if !pos.Within(Vec3{0, 0, 0}, 13) || pos.Within(Vec3{0, 0, 0}, 12.9) {
+		t.Error("Within disagrees with Distance")
+	}
+
+	if out, _ := json.Marshal(pos); string(out) != `[3,4,12]` {
+		t.Errorf("marshalled as %s", out)
+	}
+
+	for _, value := range []string{`[1, 2]`, `[1, 2, 3, 4]`, `"Sol"`} {
+		pos = Vec3{3, 4, 12}
+
+		if err := json.Unmarshal([]byte(value), &pos); err != nil || pos != (Vec3{}) {
+			t.Errorf("%s gave %v, %v", value, pos, err)
+		}
+
+		if pos.decodeError([]byte(value)) == nil {
+			t.Errorf("%s accepted as coordinates", value)
+		}
+	}
+}
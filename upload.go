@@ -2,102 +2,163 @@ package EDDNClient
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/xeipuuv/gojsonschema"
 	"io"
 	"io/ioutil"
-	"log"
+	"math/rand"
 	"net/http"
 	"time"
 )
 
-const (
-	blackmarketSchema = iota
-	commoditySchema   = iota
-	journalSchema     = iota
-	outfittingSchema  = iota
-	shipyardSchema    = iota
-)
-
-// Current schema URI's
-const bmSchemaURI = "https://raw.githubusercontent.com/jamesremuscat/EDDN/master/schemas/blackmarket-v1.0.json"
-const comSchemaURI = "https://raw.githubusercontent.com/jamesremuscat/EDDN/master/schemas/commodity-v3.0.json"
-const jSchemaURI = "https://raw.githubusercontent.com/jamesremuscat/EDDN/master/schemas/journal-v1.0.json"
-const outfSchemaURI = "https://raw.githubusercontent.com/jamesremuscat/EDDN/master/schemas/outfitting-v2.0.json"
-const shipSchemaURI = "https://raw.githubusercontent.com/jamesremuscat/EDDN/master/schemas/shipyard-v2.0.json"
-
 // Uploader is a helper type (required) that keeps track of the header, and
 // other potential portions of data that don't need to be regenerated after
 // each message.  It also updates its timestamp internally on each message
-// so it shouldn't ever be off time.
+// so it shouldn't ever be off time.  An Uploader is safe for concurrent use.
 type Uploader struct {
-	header            Header               // header sent with each message.
-	blackmarketSchema *gojsonschema.Schema // JSON validation for blackmarket messages
-	commoditySchema   *gojsonschema.Schema // JSON validation for commodity messages
-	journalSchema     *gojsonschema.Schema // JSON validation for journal messages
-	outfittingSchema  *gojsonschema.Schema // JSON validation for outfitting messages
-	shipyardSchema    *gojsonschema.Schema // JSON validation for shipyard messages
+	header    Header          // header sent with each message.
+	registry  *SchemaRegistry // Schemas, and JSON validation, for each message
+	test      bool            // Send using the /test schemas
+	gateway   string          // URL messages are POSTed to
+	client    *http.Client    // Client messages are POSTed with
+	userAgent string          // User-Agent of every request
+	headers   http.Header     // Other headers added to every request
+
+	maxRetries      int           // Retries of each message
+	retryBackoff    time.Duration // Wait before the first retry
+	maxRetryBackoff time.Duration // Longest wait between retries
+
+	compression          Compression // Content-Encoding of large bodies
+	compressionThreshold int         // Size from which bodies are compressed
 }
 
+// UploaderOptions customises an Uploader created by NewUploaderWithOptions.
+type UploaderOptions struct {
+	Registry *SchemaRegistry // Schemas that can be sent.  Defaults to NewSchemaRegistry's.
+	Test     bool            // Send using the /test schemas, so that nothing sent is taken as real data
+
+	GatewayURL string       // Where messages are POSTed.  Defaults to EDDNUploadAddress.
+	Client     *http.Client // Client for sending, with any timeouts, proxies, or TLS config.  Defaults to one with a 30s timeout.
+	UserAgent  string       // User-Agent of every request.  Defaults to "EDDNClient/" and the Version.
+	Headers    http.Header  // Other headers added to every request
+
+	MaxRetries      int           // Retries after a network error, or a 5xx, 408, or 429 response.  Defaults to 3; negative disables them.
+	RetryBackoff    time.Duration // Initial wait between retries, jittered and doubled after each.  Defaults to 1s.
+	MaxRetryBackoff time.Duration // Longest wait between retries.  Defaults to 30s.
+
+	Compression          Compression // How bodies are compressed.  Defaults to CompressNone.
+	CompressionThreshold int         // Bytes from which bodies are compressed.  Defaults to 1024.
+}
+
+// Compression is the Content-Encoding an Uploader compresses message bodies
+// with, both of which the EDDN gateway accepts.
+type Compression int
+
+// The available compressions.
+const (
+	CompressNone Compression = iota // Bodies are sent as plain JSON
+	CompressZlib                    // Bodies are zlib compressed, as "deflate"
+	CompressGzip                    // Bodies are gzip compressed
+)
+
+// The defaults for UploaderOptions.
+const (
+	defaultUploadTimeout   = 30 * time.Second
+	defaultMaxRetries      = 3
+	defaultRetryBackoff    = time.Second
+	defaultMaxRetryBackoff = 30 * time.Second
+
+	defaultCompressionThreshold = 1024
+)
+
 // NewUploader creates a new Uploader that will be used to send various types
 // of messages.  uploaderID, softwareName, and softwareVersion should be set
 // to values that you want represented in the header of every message you send.
 func NewUploader(uploaderID string, softwareName string,
 	softwareVersion string) (uploader *Uploader, err error) {
+	return NewUploaderWithOptions(uploaderID, softwareName, softwareVersion,
+		UploaderOptions{})
+}
+
+// NewUploaderWithOptions behaves like NewUploader, but sends the schemas in
+// opts.Registry, which may include schemas registered by the application, to
+// the gateway and with the HTTP client described by opts.
+func NewUploaderWithOptions(uploaderID string, softwareName string,
+	softwareVersion string, opts UploaderOptions) (uploader *Uploader, err error) {
 	header, err := generateHeader(uploaderID, softwareName, softwareVersion)
 
 	if err != nil {
 		return nil, err
 	}
 
-	var e error
+	registry := opts.Registry
 
-	schemaLoad := func(uri string) *gojsonschema.Schema {
-		if e != nil {
-			return nil
+	if registry == nil {
+		registry = defaultRegistry
+	}
+
+	// Prepare various schemas for validation.
+	for _, def := range registry.Schemas() {
+		if _, err = registry.validator(def); err != nil {
+			return nil, err
 		}
+	}
 
-		loader := gojsonschema.NewReferenceLoader(uri)
-		var schema *gojsonschema.Schema
-		schema, e = gojsonschema.NewSchema(loader)
+	uploader = &Uploader{
+		header:    header,
+		registry:  registry,
+		test:      opts.Test,
+		gateway:   opts.GatewayURL,
+		client:    opts.Client,
+		userAgent: opts.UserAgent,
+		headers:   opts.Headers,
+
+		maxRetries:      opts.MaxRetries,
+		retryBackoff:    opts.RetryBackoff,
+		maxRetryBackoff: opts.MaxRetryBackoff,
+
+		compression:          opts.Compression,
+		compressionThreshold: opts.CompressionThreshold,
+	}
 
-		return schema
+	if uploader.gateway == "" {
+		uploader.gateway = EDDNUploadAddress
 	}
 
-	// Prepare various schemas for validation.
-	bmSchema := schemaLoad(bmSchemaURI)
-	comSchema := schemaLoad(comSchemaURI)
-	jSchema := schemaLoad(jSchemaURI)
-	outSchema := schemaLoad(outfSchemaURI)
-	shipSchema := schemaLoad(shipSchemaURI)
+	if uploader.client == nil {
+		uploader.client = &http.Client{Timeout: defaultUploadTimeout}
+	}
 
-	if e != nil {
-		return nil, e
+	if uploader.userAgent == "" {
+		major, minor, revision := Version()
+		uploader.userAgent = fmt.Sprintf("EDDNClient/%d.%d.%d", major, minor, revision)
 	}
 
-	return &Uploader{header, bmSchema, comSchema, jSchema, outSchema,
-		shipSchema}, nil
-}
+	if uploader.maxRetries == 0 {
+		uploader.maxRetries = defaultMaxRetries
+	}
 
-func generateSchema(schemaType int) (schema string, err error) {
+	if uploader.retryBackoff <= 0 {
+		uploader.retryBackoff = defaultRetryBackoff
+	}
 
-	switch schemaType {
-	case blackmarketSchema:
-		return "http://schemas.elite-markets.net/eddn/blackmarket/1", nil
-	case commoditySchema:
-		return "http://schemas.elite-markets.net/eddn/commodity/3", nil
-	case journalSchema:
-		return "http://schemas.elite-markets.net/eddn/journal/1", nil
-	case outfittingSchema:
-		return "http://schemas.elite-markets.net/eddn/outfitting/2", nil
-	case shipyardSchema:
-		return "http://schemas.elite-markets.net/eddn/shipyard/2", nil
-	default:
-		return "", errors.New("Invalid schema provided")
+	if uploader.maxRetryBackoff <= 0 {
+		uploader.maxRetryBackoff = defaultMaxRetryBackoff
+	}
+
+	if uploader.maxRetryBackoff < uploader.retryBackoff {
+		uploader.maxRetryBackoff = uploader.retryBackoff
+	}
+
+	if uploader.compressionThreshold <= 0 {
+		uploader.compressionThreshold = defaultCompressionThreshold
 	}
 
+	return uploader, nil
 }
 
 func generateHeader(uploaderID string, softwareName string,
@@ -114,237 +175,434 @@ func generateHeader(uploaderID string, softwareName string,
 	return newHeader, nil
 }
 
-// Updates the header to the current time.  Nothing else really needs to
-// change.
-func (uploader *Uploader) updateHeader() {
-	uploader.header.GatewayTimestamp = GenerateUTCDateTime()
+// currentHeader returns the header updated to the current time.  Nothing
+// else really needs to change.  The Uploader's own copy is left as it is so
+// that messages may be sent concurrently.
+func (uploader *Uploader) currentHeader() Header {
+	header := uploader.header
+	header.GatewayTimestamp = GenerateUTCDateTime()
+
+	return header
 }
 
-// GenerateUTCDateTime is a helper function for generating RFC3339Nano time
-// strings.
+// GenerateUTCDateTime is a helper function for generating RFC3339 time
+// strings, to the second, as used in the header.
 func GenerateUTCDateTime() (timeString string) {
 	UTCTime := time.Now().UTC()
 
 	return UTCTime.Format(time.RFC3339)
 }
 
-func checkResponse(body io.ReadCloser) (err error) {
-	output, _ := ioutil.ReadAll(body)
+// GenerateUTCTimestamp returns the current time, in UTC and to the second,
+// for use in the Timestamp of a message.
+func GenerateUTCTimestamp() Timestamp {
+	return Timestamp{time.Now().UTC().Truncate(time.Second)}
+}
 
-	if string(output) != "OK" {
-		errStr := fmt.Sprintf("Error sending data: %s\n", output)
-		return errors.New(errStr)
+// compress returns data compressed as set by UploaderOptions, and the
+// Content-Encoding to send it with, which is "" if it was left as it is.
+func (uploader *Uploader) compress(data []byte) (body []byte, encoding string, err error) {
+	if uploader.compression == CompressNone || len(data) < uploader.compressionThreshold {
+		return data, "", nil
 	}
 
-	return nil
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch uploader.compression {
+	case CompressZlib:
+		w, encoding = zlib.NewWriter(&buf), "deflate"
+	case CompressGzip:
+		w, encoding = gzip.NewWriter(&buf), "gzip"
+	default:
+		return nil, "", fmt.Errorf("unknown compression %d", uploader.compression)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return nil, "", err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), encoding, nil
 }
 
-func (uploader *Uploader) sendMessage(msg interface{}) (err error) {
-	jsonData, err := json.Marshal(msg)
+// post makes a single attempt at sending body, with the Content-Encoding
+// encoding, to the gateway, returning an *ErrTransport if it couldn't be
+// delivered and an *ErrGatewayRejected if the gateway didn't reply "OK".
+func (uploader *Uploader) post(ctx context.Context, body []byte,
+	encoding string) (err error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploader.gateway,
+		bytes.NewReader(body))
 
 	if err != nil {
 		return err
 	}
 
-	buf := bytes.NewBuffer(jsonData)
+	for name, values := range uploader.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", uploader.userAgent)
 
-	resp, err := http.Post(EDDNUploadAddress, "application/json; charset=utf-8",
-		buf)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := uploader.client.Do(req)
 
 	if err != nil {
-		return err
+		return &ErrTransport{err}
 	}
 
 	defer resp.Body.Close()
 
-	return checkResponse(resp.Body)
+	output, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return &ErrTransport{err}
+	}
+
+	if resp.StatusCode != http.StatusOK || string(output) != "OK" {
+		return &ErrGatewayRejected{resp.StatusCode, string(output)}
+	}
+
+	return nil
 }
 
-func validateMessage(schema *gojsonschema.Schema, data interface{}) (err error) {
-	loader := gojsonschema.NewGoLoader(data)
-	result, err := schema.Validate(loader)
+// retryable reports whether a message that failed to send with err may
+// succeed if sent again: that is, if it wasn't delivered, the gateway
+// failed rather than rejecting it, or it asked for the message to be sent
+// later with 408 Request Timeout or 429 Too Many Requests.
+func retryable(err error) bool {
+	var rejected *ErrGatewayRejected
+
+	if errors.As(err, &rejected) {
+		return rejected.StatusCode >= 500 ||
+			rejected.StatusCode == http.StatusRequestTimeout ||
+			rejected.StatusCode == http.StatusTooManyRequests
+	}
+
+	var transport *ErrTransport
+
+	return errors.As(err, &transport)
+}
+
+// jitter returns a random duration between half of, and all of, backoff, so
+// that uploaders failing together don't all retry together.
+func jitter(backoff time.Duration) time.Duration {
+	half := int64(backoff / 2)
+
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// sendMessage sends data to the gateway, retrying the errors retryable
+// accepts after a jittered backoff that doubles with every attempt.  It
+// gives up, returning the last error, once the retries are used up, or
+// ctx's error if it is done first.
+func (uploader *Uploader) sendMessage(ctx context.Context, data []byte) (err error) {
+	body, encoding, err := uploader.compress(data)
 
 	if err != nil {
 		return err
 	}
 
-	if !result.Valid() {
-		log.Printf("The document is not valid. see errors :\n")
-		for _, err := range result.Errors() {
-			// Err implements the ResultError interface
-			log.Printf("- %s\n", err)
+	backoff := uploader.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err = uploader.post(ctx, body, encoding)
+
+		// A message the gateway accepted stays sent, even if ctx ended
+		// meanwhile.
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if attempt >= uploader.maxRetries || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(jitter(backoff))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
 		}
 
-		return errors.New("error validating message")
+		backoff *= 2
+
+		if backoff > uploader.maxRetryBackoff {
+			backoff = uploader.maxRetryBackoff
+		}
 	}
+}
 
-	return nil
+// Send sends the message body msg, such as a *CommodityMessage, to the EDDN
+// servers using the schema registered for its type, or its /test variant if
+// UploaderOptions.Test was set.  The message should be filled (especially the
+// required fields).
+func (uploader *Uploader) Send(msg interface{}) (err error) {
+	return uploader.SendContext(context.Background(), msg)
 }
 
-// SendBlackmarket sends a blackmarket message to the EDDN servers.  The
-// message should be filled (especially the required fields).  The required
-// fields are marked in the blackmarket.go source file.
-func (uploader *Uploader) SendBlackmarket(msg *BlackmarketMessage) (err error) {
-	schema, err := generateSchema(blackmarketSchema)
+// SendContext is Send, giving up once ctx is done.  Messages that don't
+// match their JSON Schema are not sent, and an *ErrValidation is returned.
+// Otherwise, network errors, and 5xx, 408, and 429 responses from the
+// gateway, are retried as set by UploaderOptions; should they persist an
+// *ErrTransport or *ErrGatewayRejected is returned, as it is straight away
+// for messages the gateway rejects outright.
+func (uploader *Uploader) SendContext(ctx context.Context, msg interface{}) (err error) {
+	data, err := uploader.prepare(msg)
 
 	if err != nil {
 		return err
 	}
 
-	uploader.updateHeader()
+	return uploader.sendMessage(ctx, data)
+}
 
-	data := &Blackmarket{schema, uploader.header, *msg}
+// prepare wraps the message body msg in a message with the current header,
+// and returns its JSON once validated.
+func (uploader *Uploader) prepare(msg interface{}) (jsonData []byte, err error) {
+	def, ok := uploader.registry.LookupMessage(msg)
 
-	if err = validateMessage(uploader.blackmarketSchema, data); err != nil {
-		return err
+	if !ok {
+		return nil, fmt.Errorf("no schema registered for %T", msg)
 	}
 
-	return uploader.sendMessage(data)
-}
+	schemaRef := def.URI
 
-// SendCommodity sends a commodity message to the EDDN servers.  The
-// message should be filled (especially the required fields).  The required
-// fields are marked in the commodity.go source file.
-func (uploader *Uploader) SendCommodity(msg *CommodityMessage) (err error) {
-	schema, err := generateSchema(commoditySchema)
+	if uploader.test {
+		if def.TestURI == "" {
+			return nil, fmt.Errorf("schema %s has no test variant", def.URI)
+		}
+
+		schemaRef = def.TestURI
+	}
+
+	data, err := def.encode(schemaRef, uploader.currentHeader(), msg)
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	jsonData, err = json.Marshal(data)
+
+	if err != nil {
+		return nil, err
 	}
 
-	uploader.updateHeader()
+	err = uploader.registry.validate(def, jsonData)
 
-	data := &Commodity{schema, uploader.header, *msg}
+	var validationErr *ValidationError
 
-	if err = validateMessage(uploader.commoditySchema, data); err != nil {
-		return err
+	if errors.As(err, &validationErr) {
+		return nil, &ErrValidation{schemaRef, err}
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
-	return uploader.sendMessage(data)
+	return jsonData, nil
+}
+
+// SendBlackmarket sends a blackmarket message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the blackmarket.go source file.
+func (uploader *Uploader) SendBlackmarket(msg *BlackmarketMessage) (err error) {
+	return uploader.Send(msg)
+}
+
+// SendBlackmarketContext is SendBlackmarket, sending msg with SendContext.
+func (uploader *Uploader) SendBlackmarketContext(ctx context.Context,
+	msg *BlackmarketMessage) (err error) {
+
+	return uploader.SendContext(ctx, msg)
+}
+
+// SendCommodity sends a commodity message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the commodity.go source file.
+func (uploader *Uploader) SendCommodity(msg *CommodityMessage) (err error) {
+	return uploader.Send(msg)
+}
+
+// SendCommodityContext is SendCommodity, sending msg with SendContext.
+func (uploader *Uploader) SendCommodityContext(ctx context.Context,
+	msg *CommodityMessage) (err error) {
+
+	return uploader.SendContext(ctx, msg)
 }
 
 // SendJournalDocked sends a Docked message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the journal.go source file.
 func (uploader *Uploader) SendJournalDocked(msg *JournalDocked) (err error) {
-	schema, err := generateSchema(journalSchema)
+	return uploader.Send(msg)
+}
 
-	if err != nil {
-		return err
-	}
+// SendJournalDockedContext is SendJournalDocked, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalDockedContext(ctx context.Context,
+	msg *JournalDocked) (err error) {
 
-	uploader.updateHeader()
+	return uploader.SendContext(ctx, msg)
+}
 
-	data := &Journal{schema, uploader.header, *msg}
+// SendJournalFSDJump sends a FSDJump message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the journal.go source file.
+func (uploader *Uploader) SendJournalFSDJump(msg *JournalFSDJump) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err = validateMessage(uploader.journalSchema, data); err != nil {
-		return err
-	}
+// SendJournalFSDJumpContext is SendJournalFSDJump, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalFSDJumpContext(ctx context.Context,
+	msg *JournalFSDJump) (err error) {
 
-	return uploader.sendMessage(data)
+	return uploader.SendContext(ctx, msg)
 }
 
-// SendJournalFSDJump sends a FSDJump message to the EDDN servers.  The
+// SendJournalScanStar sends a star Scan message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the journal.go source file.
-func (uploader *Uploader) SendJournalFSDJump(msg *JournalFSDJump) (err error) {
-	schema, err := generateSchema(journalSchema)
+func (uploader *Uploader) SendJournalScanStar(msg *JournalScanStar) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err != nil {
-		return err
-	}
+// SendJournalScanStarContext is SendJournalScanStar, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalScanStarContext(ctx context.Context,
+	msg *JournalScanStar) (err error) {
 
-	uploader.updateHeader()
+	return uploader.SendContext(ctx, msg)
+}
 
-	data := &Journal{schema, uploader.header, *msg}
+// SendJournalScanPlanet sends a planet Scan message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the journal.go source file.
+func (uploader *Uploader) SendJournalScanPlanet(msg *JournalScanPlanet) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err = validateMessage(uploader.journalSchema, data); err != nil {
-		return err
-	}
+// SendJournalScanPlanetContext is SendJournalScanPlanet, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalScanPlanetContext(ctx context.Context,
+	msg *JournalScanPlanet) (err error) {
 
-	return uploader.sendMessage(data)
+	return uploader.SendContext(ctx, msg)
 }
 
-// SendJournalScanStar sends a star Scan message to the EDDN servers.  The
+// SendJournalLocation sends a Location message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the journal.go source file.
-func (uploader *Uploader) SendJournalScanStar(msg *JournalScanStar) (err error) {
-	schema, err := generateSchema(journalSchema)
+func (uploader *Uploader) SendJournalLocation(msg *JournalLocation) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err != nil {
-		return err
-	}
+// SendJournalLocationContext is SendJournalLocation, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalLocationContext(ctx context.Context,
+	msg *JournalLocation) (err error) {
 
-	uploader.updateHeader()
+	return uploader.SendContext(ctx, msg)
+}
 
-	data := &Journal{schema, uploader.header, *msg}
+// SendJournalCarrierJump sends a CarrierJump message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the journal.go source file.
+func (uploader *Uploader) SendJournalCarrierJump(msg *JournalCarrierJump) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err = validateMessage(uploader.journalSchema, data); err != nil {
-		return err
-	}
+// SendJournalCarrierJumpContext is SendJournalCarrierJump, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalCarrierJumpContext(ctx context.Context,
+	msg *JournalCarrierJump) (err error) {
 
-	return uploader.sendMessage(data)
+	return uploader.SendContext(ctx, msg)
 }
 
-// SendJournalScanPlanet sends a planet Scan message to the EDDN servers.  The
+// SendJournalSAASignalsFound sends a SAASignalsFound message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the journal.go source file.
-func (uploader *Uploader) SendJournalScanPlanet(msg *JournalScanPlanet) (err error) {
-	schema, err := generateSchema(journalSchema)
+func (uploader *Uploader) SendJournalSAASignalsFound(msg *JournalSAASignalsFound) (err error) {
+	return uploader.Send(msg)
+}
 
-	if err != nil {
-		return err
-	}
+// SendJournalSAASignalsFoundContext is SendJournalSAASignalsFound, sending
+// msg with SendContext.
+func (uploader *Uploader) SendJournalSAASignalsFoundContext(ctx context.Context,
+	msg *JournalSAASignalsFound) (err error) {
 
-	uploader.updateHeader()
+	return uploader.SendContext(ctx, msg)
+}
 
-	data := &Journal{schema, uploader.header, *msg}
+// SendJournalCodexEntry sends a CodexEntry message to the EDDN servers.  The
+// message should be filled (especially the required fields).  The required
+// fields are marked in the journal.go source file.  StarSystem is filled in
+// from System if need be, and Latitude and Longitude, which the gateway
+// doesn't accept, are left out.
+func (uploader *Uploader) SendJournalCodexEntry(msg *JournalCodexEntry) (err error) {
+	return uploader.Send(codexEntryForUpload(msg))
+}
 
-	if err = validateMessage(uploader.journalSchema, data); err != nil {
-		return err
+// SendJournalCodexEntryContext is SendJournalCodexEntry, sending msg with
+// SendContext.
+func (uploader *Uploader) SendJournalCodexEntryContext(ctx context.Context,
+	msg *JournalCodexEntry) (err error) {
+
+	return uploader.SendContext(ctx, codexEntryForUpload(msg))
+}
+
+// codexEntryForUpload returns a copy of msg as the gateway accepts it.
+func codexEntryForUpload(msg *JournalCodexEntry) *JournalCodexEntry {
+	upload := *msg
+
+	if upload.StarSystem == "" {
+		upload.StarSystem = upload.System
 	}
 
-	return uploader.sendMessage(data)
+	upload.Latitude = 0
+	upload.Longitude = 0
+
+	return &upload
 }
 
 // SendOutfitting sends a outfitting message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the outfitting.go source file.
 func (uploader *Uploader) SendOutfitting(msg *OutfittingMessage) (err error) {
-	schema, err := generateSchema(commoditySchema)
-
-	if err != nil {
-		return err
-	}
-
-	uploader.updateHeader()
-
-	data := &Outfitting{schema, uploader.header, *msg}
+	return uploader.Send(msg)
+}
 
-	if err = validateMessage(uploader.outfittingSchema, data); err != nil {
-		return err
-	}
+// SendOutfittingContext is SendOutfitting, sending msg with SendContext.
+func (uploader *Uploader) SendOutfittingContext(ctx context.Context,
+	msg *OutfittingMessage) (err error) {
 
-	return uploader.sendMessage(data)
+	return uploader.SendContext(ctx, msg)
 }
 
 // SendShipyard sends a shipyard message to the EDDN servers.  The
 // message should be filled (especially the required fields).  The required
 // fields are marked in the shipyard.go source file.
 func (uploader *Uploader) SendShipyard(msg *ShipyardMessage) (err error) {
-	schema, err := generateSchema(commoditySchema)
-
-	if err != nil {
-		return err
-	}
-
-	uploader.updateHeader()
-
-	data := &Shipyard{schema, uploader.header, *msg}
+	return uploader.Send(msg)
+}
 
-	if err = validateMessage(uploader.shipyardSchema, data); err != nil {
-		return err
-	}
+// SendShipyardContext is SendShipyard, sending msg with SendContext.
+func (uploader *Uploader) SendShipyardContext(ctx context.Context,
+	msg *ShipyardMessage) (err error) {
 
-	return uploader.sendMessage(data)
+	return uploader.SendContext(ctx, msg)
 }
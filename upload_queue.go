@@ -0,0 +1,188 @@
+package EDDNClient
+
+import (
+	"context"
+	"sync"
+)
+
+// An UploadQueue sends messages with an Uploader in the background, so that
+// callers needn't wait on the gateway.  Enqueue never blocks; the messages
+// accepted are sent by a pool of worker goroutines, so with more than one
+// worker they aren't necessarily sent in the order they were queued.
+//
+// The outcome of each message is available from the PendingUpload returned
+// by Enqueue, and, if UploadQueueOptions.Results is set, on Results.  The
+// workers wait for Results to be read, other than once Shutdown has given
+// up, when any results not read are dropped.
+type UploadQueue struct {
+	Results <-chan *PendingUpload // Every message once sent, or given up on, if asked for.  Closed by Shutdown.
+
+	uploader *Uploader
+	queue    chan *PendingUpload // Messages waiting for a worker
+	results  chan *PendingUpload // Results, if set
+	done     chan struct{}       // Closed once every worker has returned
+	cancel   context.CancelFunc  // Abandons messages still being sent
+
+	mu     sync.RWMutex // Guards closed, and sending on queue
+	closed bool         // Whether Shutdown has been called
+}
+
+// UploadQueueOptions customises an UploadQueue created by NewUploadQueue.
+type UploadQueueOptions struct {
+	Workers  int  // Messages sent at once.  Defaults to 1.
+	Capacity int  // Messages waiting to be sent before Enqueue fails.  Defaults to 64.
+	Results  bool // Send every message on Results once done with, which should then be read
+}
+
+// defaultQueueCapacity is the Capacity of an UploadQueue if none is given.
+const defaultQueueCapacity = 64
+
+// A PendingUpload is a single message accepted by an UploadQueue.
+type PendingUpload struct {
+	Message interface{} // The message body, as passed to Enqueue
+
+	done chan struct{}
+	err  error
+}
+
+// Done returns a channel that's closed once the message has been sent, or
+// given up on.
+func (upload *PendingUpload) Done() <-chan struct{} {
+	return upload.done
+}
+
+// Err returns the error sending the message, as returned by
+// Uploader.SendContext, once Done is closed.  Before then it returns nil.
+func (upload *PendingUpload) Err() error {
+	select {
+	case <-upload.done:
+		return upload.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the message to be sent, returning the error sending it, or
+// ctx's error if ctx is done first.
+func (upload *PendingUpload) Wait(ctx context.Context) error {
+	select {
+	case <-upload.done:
+		return upload.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewUploadQueue creates an UploadQueue sending messages with uploader, and
+// starts its workers.  Shutdown must be called to stop them.
+func NewUploadQueue(uploader *Uploader, opts UploadQueueOptions) *UploadQueue {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+
+	if opts.Capacity < 1 {
+		opts.Capacity = defaultQueueCapacity
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := &UploadQueue{
+		uploader: uploader,
+		queue:    make(chan *PendingUpload, opts.Capacity),
+		done:     make(chan struct{}),
+		cancel:   cancel,
+	}
+
+	if opts.Results {
+		q.results = make(chan *PendingUpload, opts.Capacity)
+		q.Results = q.results
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			q.work(ctx)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+
+		if q.results != nil {
+			close(q.results)
+		}
+
+		close(q.done)
+	}()
+
+	return q
+}
+
+// work sends queued messages until the queue is closed and empty.
+func (q *UploadQueue) work(ctx context.Context) {
+	for upload := range q.queue {
+		upload.err = q.uploader.SendContext(ctx, upload.Message)
+		close(upload.done)
+
+		// Results nobody is reading are dropped once Shutdown gives up.
+		if q.results != nil {
+			select {
+			case q.results <- upload:
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+// Enqueue queues the message body msg, as would be passed to Uploader.Send,
+// for sending, without waiting.  It returns ErrQueueFull if the queue is at
+// capacity, and ErrQueueClosed once Shutdown has been called.
+func (q *UploadQueue) Enqueue(msg interface{}) (upload *PendingUpload, err error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	upload = &PendingUpload{Message: msg, done: make(chan struct{})}
+
+	select {
+	case q.queue <- upload:
+		return upload, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Shutdown stops the queue accepting messages, and waits for those already
+// queued to be sent.  Should ctx be done first, the messages still being
+// sent are abandoned, as are any not yet started, finishing with
+// context.Canceled, and Shutdown returns ctx's error once the workers have
+// stopped.  It is safe to call Shutdown more than once.
+func (q *UploadQueue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+
+		return ctx.Err()
+	}
+}
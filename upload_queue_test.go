@@ -0,0 +1,186 @@
+package EDDNClient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestQueue returns an UploadQueue sending to a stand-in gateway, which
+// signals on arrived as each message arrives, and replies to it once release
+// is sent on, or closed.
+func newTestQueue(t *testing.T, opts UploadQueueOptions) (q *UploadQueue,
+	release chan struct{}, arrived chan struct{}, server *httptest.Server) {
+
+	release = make(chan struct{})
+	arrived = make(chan struct{}, 16)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request is only cancelled once its body has been read.
+		ioutil.ReadAll(r.Body)
+		arrived <- struct{}{}
+
+		select {
+		case <-release:
+			w.Write([]byte("OK"))
+		case <-r.Context().Done():
+		}
+	}))
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL: server.URL,
+		Client:     server.Client(),
+		MaxRetries: -1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewUploadQueue(uploader, opts), release, arrived, server
+}
+
+// enqueue queues a test message on q.
+func enqueue(t *testing.T, q *UploadQueue) *PendingUpload {
+	upload, err := q.Enqueue(testBlackmarket())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return upload
+}
+
+func TestUploadQueue(t *testing.T) {
+	q, release, arrived, server := newTestQueue(t, UploadQueueOptions{Workers: 2,
+		Capacity: 2, Results: true})
+
+	defer server.Close()
+
+	results := make(chan int)
+
+	go func() {
+		var count int
+
+		for range q.Results {
+			count++
+		}
+
+		results <- count
+	}()
+
+	// Two messages are taken by the workers, and two more fill the queue.
+	uploads := []*PendingUpload{enqueue(t, q), enqueue(t, q)}
+
+	<-arrived
+	<-arrived
+
+	uploads = append(uploads, enqueue(t, q), enqueue(t, q))
+
+	if _, err := q.Enqueue(testBlackmarket()); err != ErrQueueFull {
+		t.Errorf("got %v enqueueing to a full queue", err)
+	}
+
+	if err := uploads[0].Err(); err != nil {
+		t.Errorf("got %v before the message was sent", err)
+	}
+
+	close(release)
+
+	for _, upload := range uploads {
+		if err := upload.Wait(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := <-results; count != len(uploads) {
+		t.Errorf("got %d results, want %d", count, len(uploads))
+	}
+
+	if _, err := q.Enqueue(testBlackmarket()); err != ErrQueueClosed {
+		t.Errorf("got %v enqueueing after Shutdown", err)
+	}
+}
+
+func TestUploadQueueShutdownDeadline(t *testing.T) {
+	q, _, arrived, server := newTestQueue(t, UploadQueueOptions{})
+
+	defer server.Close()
+
+	sending := enqueue(t, q)
+	<-arrived
+	waiting := enqueue(t, q)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := q.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v from Shutdown, want the deadline", err)
+	}
+
+	for _, upload := range []*PendingUpload{sending, waiting} {
+		if err := upload.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v for an abandoned message", err)
+		}
+	}
+}
+
+func TestUploadQueueShutdownUnreadResults(t *testing.T) {
+	q, release, arrived, server := newTestQueue(t, UploadQueueOptions{Capacity: 1,
+		Results: true})
+
+	defer server.Close()
+
+	close(release)
+
+	// The first result fills Results, leaving the worker waiting to send
+	// the second, and the third waiting for the worker.
+	first := enqueue(t, q)
+	<-first.Done()
+	second := enqueue(t, q)
+	<-arrived
+	<-arrived
+	third := enqueue(t, q)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan error)
+
+	go func() {
+		stopped <- q.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != context.DeadlineExceeded {
+			t.Errorf("got %v from Shutdown, want the deadline", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown ignored its deadline")
+	}
+
+	if second.Err() != nil || !errors.Is(third.Err(), context.Canceled) {
+		t.Errorf("got %v, and %v for the message not sent", second.Err(), third.Err())
+	}
+
+	// Only the result read in time is on Results.
+	var results []*PendingUpload
+
+	for upload := range q.Results {
+		results = append(results, upload)
+	}
+
+	if len(results) != 1 || results[0] != first {
+		t.Errorf("got %d results, want the first", len(results))
+	}
+}
@@ -0,0 +1,379 @@
+package EDDNClient
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBlackmarket returns a valid blackmarket message body.
+func testBlackmarket() *BlackmarketMessage {
+	return &BlackmarketMessage{
+		Name:        "usscargoblackbox",
+		SellPrice:   1806,
+		SystemName:  "Pleione",
+		StationName: "Stargazer",
+		Timestamp:   GenerateUTCTimestamp(),
+	}
+}
+
+func TestUploaderOptions(t *testing.T) {
+	var got *http.Request
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+
+		w.Write([]byte("OK"))
+	}))
+
+	defer server.Close()
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		Test:       true,
+		GatewayURL: server.URL + "/upload/",
+		Client:     server.Client(),
+		UserAgent:  "test/1.0",
+		Headers:    http.Header{"X-Test": {"yes"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = uploader.SendBlackmarket(testBlackmarket()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/upload/" {
+		t.Errorf("got %s %s", got.Method, got.URL.Path)
+	}
+
+	if agent := got.Header.Get("User-Agent"); agent != "test/1.0" {
+		t.Errorf("got User-Agent %q", agent)
+	}
+
+	if value := got.Header.Get("X-Test"); value != "yes" {
+		t.Errorf("got X-Test %q", value)
+	}
+
+	var msg Blackmarket
+
+	if err = json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.SchemaRef != "http://schemas.elite-markets.net/eddn/blackmarket/1/test" ||
+		msg.Header.UploaderID != "cmdr" || msg.Message.Name != "usscargoblackbox" {
+		t.Errorf("gateway received %s", body)
+	}
+
+	// The defaults are filled in for anything not given.
+	uploader, err = NewUploader("cmdr", "test", "1.0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploader.gateway != EDDNUploadAddress || uploader.client == nil ||
+		uploader.userAgent != "EDDNClient/0.0.1" {
+		t.Errorf("got defaults %q, %v, %q", uploader.gateway, uploader.client,
+			uploader.userAgent)
+	}
+}
+
+func TestUploaderRetries(t *testing.T) {
+	var attempts int
+	var replies []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := replies[attempts]
+		attempts++
+
+		w.WriteHeader(status)
+
+		if status == http.StatusOK {
+			w.Write([]byte("OK"))
+		} else {
+			w.Write([]byte("FAIL: " + http.StatusText(status)))
+		}
+	}))
+
+	defer server.Close()
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL:   server.URL,
+		Client:       server.Client(),
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(statuses ...int) error {
+		attempts, replies = 0, statuses
+		return uploader.SendBlackmarketContext(context.Background(), testBlackmarket())
+	}
+
+	// 5xx responses are retried until one succeeds...
+	if err = send(503, 502, 200); err != nil || attempts != 3 {
+		t.Errorf("got %v after %d attempts", err, attempts)
+	}
+
+	// ...as are requests to try again later...
+	if err = send(429, 408, 200); err != nil || attempts != 3 {
+		t.Errorf("got %v after %d attempts", err, attempts)
+	}
+
+	// ...or the retries run out.
+	var rejected *ErrGatewayRejected
+
+	err = send(503, 503, 503, 200)
+
+	if !errors.As(err, &rejected) || rejected.StatusCode != 503 || attempts != 3 {
+		t.Errorf("got %v after %d attempts", err, attempts)
+	}
+
+	// Messages refused by the gateway aren't retried.
+	err = send(400, 200)
+
+	if !errors.As(err, &rejected) || rejected.StatusCode != 400 ||
+		rejected.Body != "FAIL: Bad Request" || attempts != 1 {
+		t.Errorf("got %v after %d attempts", err, attempts)
+	}
+
+	// Nor are invalid messages sent at all.
+	invalid := testBlackmarket()
+	invalid.SystemName = ""
+
+	var validationErr *ErrValidation
+
+	attempts, replies = 0, []int{200}
+	err = uploader.SendBlackmarket(invalid)
+
+	if !errors.As(err, &validationErr) || attempts != 0 {
+		t.Errorf("got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestUploaderTransportErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL:   server.URL,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transport *ErrTransport
+
+	if err = uploader.SendBlackmarket(testBlackmarket()); !errors.As(err, &transport) {
+		t.Errorf("got %v sending to a closed gateway", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err = uploader.SendBlackmarketContext(ctx, testBlackmarket()); err != context.Canceled {
+		t.Errorf("got %v sending with a cancelled context", err)
+	}
+}
+
+func TestUploaderCompression(t *testing.T) {
+	var encoding string
+	var received Blackmarket
+
+	// The stand-in gateway decompresses bodies as the real one does.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+
+		var body io.Reader = r.Body
+		var err error
+
+		switch encoding {
+		case "gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "deflate":
+			body, err = zlib.NewReader(r.Body)
+		}
+
+		if err == nil {
+			received = Blackmarket{}
+			err = json.NewDecoder(body).Decode(&received)
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write([]byte("OK"))
+	}))
+
+	defer server.Close()
+
+	tests := []struct {
+		compression Compression
+		threshold   int
+		want        string
+	}{
+		{CompressNone, 1, ""},
+		{CompressZlib, 1, "deflate"},
+		{CompressGzip, 1, "gzip"},
+		{CompressGzip, 0, ""}, // Smaller than the default threshold
+	}
+
+	for _, test := range tests {
+		uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+			GatewayURL:           server.URL,
+			Client:               server.Client(),
+			Compression:          test.compression,
+			CompressionThreshold: test.threshold,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = uploader.SendBlackmarket(testBlackmarket()); err != nil {
+			t.Errorf("compression %d: %v", test.compression, err)
+			continue
+		}
+
+		if encoding != test.want || received.Message.Name != "usscargoblackbox" {
+			t.Errorf("compression %d: sent with Content-Encoding %q, received %+v",
+				test.compression, encoding, received.Message)
+		}
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestUploaderCancelledAfterSending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The gateway accepts the message just as the context ends.
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		cancel()
+
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header),
+			Body: ioutil.NopCloser(strings.NewReader("OK"))}, nil
+	})}
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL: "http://gateway.invalid/upload/",
+		Client:     client,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = uploader.SendBlackmarketContext(ctx, testBlackmarket()); err != nil {
+		t.Errorf("got %v for a message the gateway accepted", err)
+	}
+}
+
+func TestUploaderJournalEvents(t *testing.T) {
+	var events []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct {
+			Message map[string]interface{} `json:"message"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		events = append(events, msg.Message)
+		w.Write([]byte("OK"))
+	}))
+
+	defer server.Close()
+
+	uploader, err := NewUploaderWithOptions("cmdr", "test", "1.0", UploaderOptions{
+		GatewayURL: server.URL,
+		Client:     server.Client(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := GenerateUTCTimestamp()
+	sol := Vec3{0, 0, 0}
+
+	// Each is validated against the bundled journal schema before it's sent.
+	sends := map[string]func() error{
+		"Location": func() error {
+			return uploader.SendJournalLocation(&JournalLocation{Event: "Location",
+				StarSystem: "Sol", SystemAddress: 10477373803, StarPos: sol,
+				Timestamp: now, Body: "Earth", BodyType: "Planet"})
+		},
+		"CarrierJump": func() error {
+			return uploader.SendJournalCarrierJumpContext(context.Background(),
+				&JournalCarrierJump{Event: "CarrierJump", StarSystem: "Sol",
+					SystemAddress: 10477373803, StarPos: sol, Timestamp: now,
+					Docked: true, StationName: "K7Q-BQL", StationType: "FleetCarrier"})
+		},
+		"SAASignalsFound": func() error {
+			return uploader.SendJournalSAASignalsFound(&JournalSAASignalsFound{
+				Event: "SAASignalsFound", StarSystem: "Sol", SystemAddress: 10477373803,
+				StarPos: sol, Timestamp: now, BodyName: "Earth", BodyID: 3,
+				Signals: []Signal{{Type: "$SAA_SignalType_Biological;", Count: 7}}})
+		},
+		"CodexEntry": func() error {
+			return uploader.SendJournalCodexEntry(&JournalCodexEntry{Event: "CodexEntry",
+				System: "Sol", SystemAddress: 10477373803, StarPos: sol, Timestamp: now,
+				EntryID: 2100301, Name: "$Codex_Ent_Standard_Sudarsky_Class_I_Name;",
+				Region: "$Codex_RegionName_18;", Category: "$Codex_Category_StellarBodies;",
+				SubCategory: "$Codex_SubCategory_Gas_Giants;", Latitude: 12.5})
+		},
+	}
+
+	for event, send := range sends {
+		if err = send(); err != nil {
+			t.Errorf("sending %s: %v", event, err)
+		}
+	}
+
+	if len(events) != len(sends) {
+		t.Fatalf("gateway received %d of %d events", len(events), len(sends))
+	}
+
+	for _, msg := range events {
+		if msg["event"] != "CodexEntry" {
+			continue
+		}
+
+		if _, ok := msg["Latitude"]; msg["StarSystem"] != "Sol" || ok {
+			t.Errorf("gateway received CodexEntry %v", msg)
+		}
+	}
+}
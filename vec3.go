@@ -0,0 +1,71 @@
+package EDDNClient
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Vec3 is a position in the galaxy, in light years from Sol, as in a
+// journal StarPos.  It marshals as an array of three numbers.  Anything
+// else unmarshals as a zero Vec3 rather than failing the whole message;
+// see Extras for where it is kept.
+type Vec3 [3]float64
+
+// Distance returns the distance between v and to, in light years.
+func (v Vec3) Distance(to Vec3) float64 {
+	return math.Sqrt(v.DistanceSquared(to))
+}
+
+// DistanceSquared returns the square of the distance between v and to,
+// which is cheaper than Distance when only comparing distances.
+func (v Vec3) DistanceSquared(to Vec3) float64 {
+	dx := v[0] - to[0]
+	dy := v[1] - to[1]
+	dz := v[2] - to[2]
+
+	return dx*dx + dy*dy + dz*dz
+}
+
+// Within reports whether v is no further than radius light years from
+// center.
+func (v Vec3) Within(center Vec3, radius float64) bool {
+	return v.DistanceSquared(center) <= radius*radius
+}
+
+// UnmarshalJSON decodes an array of exactly three numbers, leaving v zero
+// if data is anything else.
+func (v *Vec3) UnmarshalJSON(data []byte) (err error) {
+	*v, _ = decodeVec3(data)
+
+	return nil
+}
+
+// decodeError returns the error decoding data as coordinates, if any.
+func (Vec3) decodeError(data []byte) error {
+	_, err := decodeVec3(data)
+
+	return err
+}
+
+// decodeVec3 decodes data, which is null or an array of exactly three
+// numbers.
+func decodeVec3(data []byte) (v Vec3, err error) {
+	var values []float64
+
+	if err = json.Unmarshal(data, &values); err != nil {
+		return v, err
+	}
+
+	if values == nil {
+		return v, nil
+	}
+
+	if len(values) != 3 {
+		return v, fmt.Errorf("coordinates have %d values, not 3", len(values))
+	}
+
+	copy(v[:], values)
+
+	return v, nil
+}